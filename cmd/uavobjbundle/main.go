@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * uavobjbundle generates a Go package embedding a directory of UAVObject XML definitions,
+ * the package registers them with uavtalk.RegisterDefinitionSet when imported.
+ * The definitions are checked before being bundled.
+ *
+ * Usage, eg. with go generate:
+ *	//go:generate go run github.com/HackerLoop/rotonde-uavtalk/cmd/uavobjbundle -name taulabs-next -package taulabsnext -o bundle.go $TAULABS_DIR/shared/uavobjectdefinition
+ */
+
+func main() {
+	name := flag.String("name", "", "name of the definition set")
+	packageName := flag.String("package", "", "name of the generated package")
+	output := flag.String("o", "", "output file, stdout if empty")
+	flag.Parse()
+
+	if flag.NArg() < 1 || len(*packageName) == 0 || len(*name) == 0 {
+		log.Fatal(fmt.Sprintf("Usage: %s -package name -name set [-o file] definitions_directory", os.Args[0]))
+	}
+
+	files, err := uavtalk.ReadDefinitionFiles(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := uavtalk.NewRegistryFromFiles(files); err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := bundle(*packageName, *name, files)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(*output) == 0 {
+		os.Stdout.Write(source)
+		return
+	}
+	if err := ioutil.WriteFile(*output, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func bundle(packageName string, name string, files uavtalk.DefinitionFiles) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "// Code generated by uavobjbundle; DO NOT EDIT.\n\n")
+	fmt.Fprintf(buffer, "package %s\n\n", packageName)
+	fmt.Fprintf(buffer, "import \"github.com/HackerLoop/rotonde-uavtalk/uavtalk\"\n\n")
+	fmt.Fprintf(buffer, "func init() {\n")
+	fmt.Fprintf(buffer, "uavtalk.RegisterDefinitionSet(%s, uavtalk.DefinitionFiles{\n", strconv.Quote(name))
+	for _, fileName := range files.Names() {
+		fmt.Fprintf(buffer, "%s: []byte(%s),\n", strconv.Quote(fileName), strconv.Quote(string(files[fileName])))
+	}
+	fmt.Fprintf(buffer, "})\n}\n")
+
+	return format.Source(buffer.Bytes())
+}
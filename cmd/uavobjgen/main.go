@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * uavobjgen generates Go types from a directory of UAVObject XML definitions, so the objects can be used
+ * without map[string]interface{} and field names as strings. For each object it generates:
+ *	- a struct, fields in wire order, with a named struct for fields with element names, and arrays otherwise
+ *	- a type and constants for each enum field, with a String method
+ *	- the ObjectID and Length constants
+ *	- MarshalBinary and UnmarshalBinary methods, encoding the object data as in a UAVTalk packet, without reflection
+ * Meta objects are not generated.
+ *
+ * Usage, eg. with go generate:
+ *	//go:generate go run github.com/HackerLoop/rotonde-uavtalk/cmd/uavobjgen -package uavobjects -o uavobjects.go path/to/uavobjectdefinition/
+ */
+
+func main() {
+	packageName := flag.String("package", "uavobjects", "name of the generated package")
+	output := flag.String("o", "", "output file, stdout if empty")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal(fmt.Sprintf("Usage: %s [-package name] [-o file] definitions_directory/", os.Args[0]))
+	}
+
+	registry, err := uavtalk.LoadRegistry(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := generate(*packageName, flag.Arg(0), registry.Definitions())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(*output) == 0 {
+		os.Stdout.Write(source)
+		return
+	}
+	if err := ioutil.WriteFile(*output, source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type generator struct {
+	body bytes.Buffer
+
+	declared   map[string]string // identifier -> what declared it
+	usesBinary bool
+	usesMath   bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// declare reserves a package level identifier, two definitions can end up with the same identifiers
+func (g *generator) declare(name string, what string) error {
+	if other, exists := g.declared[name]; exists {
+		return fmt.Errorf("%s: identifier %s already declared by %s", what, name, other)
+	}
+	g.declared[name] = what
+	return nil
+}
+
+func generate(packageName string, source string, definitions uavtalk.Definitions) ([]byte, error) {
+	g := &generator{declared: map[string]string{}}
+
+	for _, definition := range definitions {
+		if definition.MetaFor != nil {
+			continue
+		}
+		if err := g.definition(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	header := new(bytes.Buffer)
+	fmt.Fprintf(header, "// Code generated by uavobjgen from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(header, "package %s\n\nimport (\n", packageName)
+	if g.usesBinary {
+		fmt.Fprintf(header, "\"encoding/binary\"\n")
+	}
+	fmt.Fprintf(header, "\"fmt\"\n")
+	if g.usesMath {
+		fmt.Fprintf(header, "\"math\"\n")
+	}
+	fmt.Fprintf(header, ")\n\n")
+	header.Write(g.body.Bytes())
+
+	formatted, err := format.Source(header.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Generated code is invalid: %s", err)
+	}
+	return formatted, nil
+}
+
+func (g *generator) definition(definition *uavtalk.Definition) error {
+	name := identifier(definition.Name)
+	for _, suffix := range []string{"", "ObjectID", "Length"} {
+		if err := g.declare(name+suffix, definition.Name); err != nil {
+			return err
+		}
+	}
+
+	// field types, enums and element structs first
+	goTypes := make(map[*uavtalk.FieldDefinition]string, len(definition.Fields))
+	fieldTypes := make(map[*uavtalk.FieldDefinition]string, len(definition.Fields))
+	for _, field := range definition.Fields {
+		goType, err := g.elementType(definition, field)
+		if err != nil {
+			return err
+		}
+		goTypes[field] = goType
+
+		switch {
+		case len(field.ElementNames) > 0 && field.Elements > 1:
+			fieldTypes[field] = name + identifier(field.Name)
+			if err := g.elementStruct(definition, field, goType); err != nil {
+				return err
+			}
+		case field.Elements > 1:
+			fieldTypes[field] = fmt.Sprintf("[%d]%s", field.Elements, goType)
+		default:
+			fieldTypes[field] = goType
+		}
+	}
+
+	g.printf("// %sObjectID is the UAVTalk object ID of %s\n", name, definition.Name)
+	g.printf("const %sObjectID = 0x%08X\n\n", name, definition.ObjectID)
+	g.printf("// %sLength is the length of the %s data\n", name, definition.Name)
+	g.printf("const %sLength = %d\n\n", name, definition.Fields.ByteLength())
+
+	description := comment(definition.Description)
+	if len(description) == 0 {
+		description = "UAVObject"
+	}
+	g.printf("// %s %s\n", name, description)
+	g.printf("type %s struct {\n", name)
+	for _, field := range definition.Fields {
+		g.printf("%s %s", identifier(field.Name), fieldTypes[field])
+		if len(field.Units) > 0 {
+			g.printf(" // %s", comment(field.Units))
+		}
+		g.printf("\n")
+	}
+	g.printf("}\n\n")
+
+	// not ObjectID, some objects have an ObjectID field (eg. ObjectPersistence)
+	g.printf("// UAVObjectID returns %sObjectID\n", name)
+	g.printf("func (o *%s) UAVObjectID() uint32 {\nreturn %sObjectID\n}\n\n", name, name)
+
+	g.printf("// MarshalBinary encodes the object as in UAVTalk packets\n")
+	g.printf("func (o *%s) MarshalBinary() ([]byte, error) {\n", name)
+	g.printf("data := make([]byte, %sLength)\n", name)
+	g.elements(definition, func(field *uavtalk.FieldDefinition, expression string, offset int) {
+		g.encode(field, expression, offset)
+	})
+	g.printf("return data, nil\n}\n\n")
+
+	g.printf("// UnmarshalBinary decodes the object from the data of a UAVTalk packet\n")
+	g.printf("func (o *%s) UnmarshalBinary(data []byte) error {\n", name)
+	g.printf("if len(data) != %sLength {\n", name)
+	g.printf("return fmt.Errorf(\"%s: %%d bytes, expected %%d\", len(data), %sLength)\n}\n", definition.Name, name)
+	g.elements(definition, func(field *uavtalk.FieldDefinition, expression string, offset int) {
+		g.decode(field, goTypes[field], expression, offset)
+	})
+	g.printf("return nil\n}\n\n")
+	return nil
+}
+
+// elementType returns the Go type of one element of field, generating the enum type if needed
+func (g *generator) elementType(definition *uavtalk.Definition, field *uavtalk.FieldDefinition) (string, error) {
+	switch field.FieldTypeInfo.Name {
+	case "int8", "int16", "int32", "uint8", "uint16", "uint32":
+		return field.FieldTypeInfo.Name, nil
+	case "float":
+		return "float32", nil
+	case "enum":
+	default:
+		return "", fmt.Errorf("%s.%s: unknown type %s", definition.Name, field.Name, field.FieldTypeInfo.Name)
+	}
+
+	typeName := identifier(definition.Name) + identifier(field.Name) + "Option"
+	what := fmt.Sprintf("%s.%s", definition.Name, field.Name)
+	if err := g.declare(typeName, what); err != nil {
+		return "", err
+	}
+
+	g.printf("// %s are the options of %s\n", typeName, what)
+	g.printf("type %s uint8\n\n", typeName)
+	g.printf("const (\n")
+	for i, option := range field.Options {
+		constName := identifier(definition.Name) + identifier(field.Name) + identifier(option)
+		if err := g.declare(constName, what); err != nil {
+			return "", err
+		}
+		g.printf("%s %s = %d\n", constName, typeName, i)
+	}
+	g.printf(")\n\n")
+
+	g.printf("func (v %s) String() string {\nswitch v {\n", typeName)
+	for i, option := range field.Options {
+		g.printf("case %d:\nreturn %q\n", i, option)
+	}
+	g.printf("}\nreturn fmt.Sprintf(\"%s(%%d)\", uint8(v))\n}\n\n", typeName)
+	return typeName, nil
+}
+
+func (g *generator) elementStruct(definition *uavtalk.Definition, field *uavtalk.FieldDefinition, goType string) error {
+	typeName := identifier(definition.Name) + identifier(field.Name)
+	what := fmt.Sprintf("%s.%s", definition.Name, field.Name)
+	if err := g.declare(typeName, what); err != nil {
+		return err
+	}
+
+	g.printf("// %s are the elements of %s\n", typeName, what)
+	g.printf("type %s struct {\n", typeName)
+	for _, elementName := range uniqueIdentifiers(field.ElementNames) {
+		g.printf("%s %s\n", elementName, goType)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+// elements calls f for each element, in wire order, with the Go expression of the element and its offset in the data
+func (g *generator) elements(definition *uavtalk.Definition, f func(field *uavtalk.FieldDefinition, expression string, offset int)) {
+	offset := 0
+	for _, field := range definition.Fields {
+		fieldName := "o." + identifier(field.Name)
+		for i := 0; i < field.Elements; i++ {
+			expression := fieldName
+			if len(field.ElementNames) > 0 && field.Elements > 1 {
+				expression = fieldName + "." + uniqueIdentifiers(field.ElementNames)[i]
+			} else if field.Elements > 1 {
+				expression = fmt.Sprintf("%s[%d]", fieldName, i)
+			}
+			f(field, expression, offset)
+			offset += field.FieldTypeInfo.Size
+		}
+	}
+}
+
+func (g *generator) encode(field *uavtalk.FieldDefinition, expression string, offset int) {
+	switch field.FieldTypeInfo.Name {
+	case "int8", "uint8", "enum":
+		g.printf("data[%d] = byte(%s)\n", offset, expression)
+	case "int16", "uint16":
+		g.usesBinary = true
+		g.printf("binary.LittleEndian.PutUint16(data[%d:], uint16(%s))\n", offset, expression)
+	case "int32", "uint32":
+		g.usesBinary = true
+		g.printf("binary.LittleEndian.PutUint32(data[%d:], uint32(%s))\n", offset, expression)
+	case "float":
+		g.usesBinary, g.usesMath = true, true
+		g.printf("binary.LittleEndian.PutUint32(data[%d:], math.Float32bits(%s))\n", offset, expression)
+	}
+}
+
+func (g *generator) decode(field *uavtalk.FieldDefinition, goType string, expression string, offset int) {
+	switch field.FieldTypeInfo.Name {
+	case "int8", "uint8", "enum":
+		g.printf("%s = %s(data[%d])\n", expression, goType, offset)
+	case "int16", "uint16":
+		g.usesBinary = true
+		g.printf("%s = %s(binary.LittleEndian.Uint16(data[%d:]))\n", expression, goType, offset)
+	case "int32", "uint32":
+		g.usesBinary = true
+		g.printf("%s = %s(binary.LittleEndian.Uint32(data[%d:]))\n", expression, goType, offset)
+	case "float":
+		g.usesBinary, g.usesMath = true, true
+		g.printf("%s = math.Float32frombits(binary.LittleEndian.Uint32(data[%d:]))\n", expression, offset)
+	}
+}
+
+// identifier turns a name from the definitions into an exported Go identifier, eg. "Rate+" -> "RatePlus", "1" -> "N1"
+func identifier(name string) string {
+	replacer := strings.NewReplacer("+", " Plus ", "-", " Minus ", "%", " Percent ", "&", " And ")
+	words := strings.FieldsFunc(replacer.Replace(name), func(r rune) bool {
+		return unicode.IsLetter(r) == false && unicode.IsDigit(r) == false
+	})
+
+	result := ""
+	for _, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		result += string(runes)
+	}
+	if len(result) == 0 || unicode.IsDigit([]rune(result)[0]) {
+		result = "N" + result
+	}
+	return result
+}
+
+// uniqueIdentifiers converts names to identifiers, suffixing the duplicates with their index
+func uniqueIdentifiers(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, len(names))
+	for i, name := range names {
+		id := identifier(name)
+		if seen[id] {
+			id = fmt.Sprintf("%s%d", id, i)
+		}
+		seen[id] = true
+		result[i] = id
+	}
+	return result
+}
+
+// comment keeps the first line of a description
+func comment(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const goldenFile = "testdata/uavobjects.golden"
+
+func TestGenerateGolden(t *testing.T) {
+	registry, err := uavtalk.LoadRegistry("testdata/definitions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := generate("uavobjects", "testdata/definitions", registry.Definitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(goldenFile, source, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(source, golden) == false {
+		t.Errorf("generated code differs from %s, run go test -update to accept it:\n%s", goldenFile, source)
+	}
+}
+
+func TestGenerateDeclaredTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavobjgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.xml": `<xml><object name="Clash" singleinstance="true" settings="false">
+			<field name="Mode" units="" type="enum" elements="1" options="A,B"/>
+			<access gcs="readwrite" flight="readwrite"/>
+			<telemetrygcs acked="false" updatemode="manual" period="0"/>
+			<telemetryflight acked="false" updatemode="manual" period="0"/>
+			<logging updatemode="manual" period="0"/>
+		</object></xml>`,
+		"b.xml": `<xml><object name="ClashModeOption" singleinstance="true" settings="false">
+			<field name="A" units="" type="uint8" elements="1"/>
+			<access gcs="readwrite" flight="readwrite"/>
+			<telemetrygcs acked="false" updatemode="manual" period="0"/>
+			<telemetryflight acked="false" updatemode="manual" period="0"/>
+			<logging updatemode="manual" period="0"/>
+		</object></xml>`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry, err := uavtalk.LoadRegistry(dir + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ClashModeOption is both the type of the Clash.Mode options and an object
+	if _, err := generate("uavobjects", "test", registry.Definitions()); err == nil {
+		t.Error("identifiers declared twice were not reported")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"Roll":          "Roll",
+		"rate":          "Rate",
+		"Rate+":         "RatePlus",
+		"-":             "Minus",
+		"10%":           "N10Percent",
+		"1":             "N1",
+		"Attitude Hold": "AttitudeHold",
+		"a&b":           "AAndB",
+		"":              "N",
+	}
+	for name, expected := range tests {
+		if id := identifier(name); id != expected {
+			t.Errorf("identifier(%q) = %q, expected %q", name, id, expected)
+		}
+	}
+
+	ids := uniqueIdentifiers([]string{"Rate+", "Rate Plus", "Off"})
+	if ids[0] != "RatePlus" || ids[1] != "RatePlus1" || ids[2] != "Off" {
+		t.Errorf("uniqueIdentifiers: %v", ids)
+	}
+}
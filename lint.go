@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+)
+
+/**
+ * The lint command checks a directory of UAVObject XML definitions, without starting the bridge:
+ *	bridge lint definitions_directory
+ * It prints all the problems found, and exits non-zero if there is any, eg. to run in CI.
+ */
+
+const lintCommand = "lint"
+
+// lint runs the lint command, returns the exit code
+func lint(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s definitions_directory\n", os.Args[0], lintCommand)
+		return 2
+	}
+
+	files, err := uavtalk.ReadDefinitionFiles(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	errs := uavtalk.ValidateDefinitionFiles(files)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		fmt.Printf("%d problems found in %d files\n", len(errs), len(files))
+		return 1
+	}
+	fmt.Printf("%d files OK\n", len(files))
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// runLint runs the lint command, returns its exit code and what it printed
+func runLint(t *testing.T, args ...string) (int, string) {
+	output, err := ioutil.TempFile("", "lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = output, output
+	code := lint(args)
+	os.Stdout, os.Stderr = stdout, stderr
+
+	printed, err := ioutil.ReadFile(output.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(printed)
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{nil, 2, "Usage: "},
+		{[]string{"a", "b"}, 2, "Usage: "},
+		{[]string{"uavtalk/testdata/missing"}, 1, "no such file or directory"},
+		{[]string{"uavtalk/testdata/invalid/duplicatename"}, 1, "1 problems found in 2 files"},
+		{[]string{"uavtalk/testdata/invalid/cloneofclone"}, 1, "CloneOfClone.CloneOfClone: clone of Clone"},
+		{[]string{"uavtalk/testdata/definitions"}, 0, "4 files OK"},
+	}
+
+	for _, test := range tests {
+		code, output := runLint(t, test.args...)
+		if code != test.code {
+			t.Errorf("lint %v: exit code %d, expected %d", test.args, code, test.code)
+		}
+		if strings.Contains(output, test.output) == false {
+			t.Errorf("lint %v: %q printed, expected %q", test.args, output, test.output)
+		}
+	}
+}
@@ -1,19 +1,26 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/HackerLoop/rotonde-client.go"
 	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	_ "github.com/HackerLoop/rotonde-uavtalk/uavtalk/definitions/core"
+	_ "github.com/HackerLoop/rotonde-uavtalk/uavtalk/fcsim"
 	"github.com/HackerLoop/rotonde/shared"
 	log "github.com/Sirupsen/logrus"
 	"github.com/vitaminwater/handlers.go"
 )
 
-const SESSION_PAUSE = 7
+const linkEventIdentifier = "UAVTALK_LINK"
+
+// timestampField holds the flight controller time (ms, wrapping at 65536) of timestamped packets
+const timestampField = "timestamp"
 
 type authPacketList []string
 
@@ -32,180 +39,122 @@ func (l authPacketList) contains(name string) bool {
  *	UAVTalk protocol implementation
  */
 
-func initAuthHandlers(root *handlers.HandlerManager, fcInChan chan uavtalk.Packet, client *client.Client) *handlers.HandlerManager {
-	sessionManaging, err := uavtalk.AllDefinitions.GetDefinitionForName("SessionManaging")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	flightTelemetryStats, err := uavtalk.AllDefinitions.GetDefinitionForName("FlightTelemetryStats")
-	if err != nil {
-		log.Fatal(err)
+func (v *Vehicle) initAuthHandlers(root *handlers.HandlerManager) *handlers.HandlerManager {
+	for _, name := range authPackets {
+		if _, err := v.connection.Registry().GetDefinitionForName(name); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	handshakeReq := uavtalk.CreateGCSTelemetryStatsObjectPacket("HandshakeReq")
-	fcInChan <- handshakeReq
-
 	filter := func(i interface{}) (interface{}, bool) {
-		p := i.(uavtalk.Packet)
-		return i, authPackets.contains(p.Definition.Name)
+		switch p := i.(type) {
+		case uavtalk.LinkState:
+			return i, true
+		case uavtalk.Packet:
+			return i, authPackets.contains(p.Definition.Name)
+		}
+		return i, false
 	}
 
-	connected := false
-	disconnectedHandler := func(i interface{}) bool {
-		p := i.(uavtalk.Packet)
-		if p.Definition == flightTelemetryStats {
-			if p.Data["Status"] == "Disconnected" {
-				connected = false
-				handshakeReq := uavtalk.CreateGCSTelemetryStatsObjectPacket("HandshakeReq")
-				fcInChan <- handshakeReq
-			} else if p.Data["Status"] == "HandshakeAck" {
-				handshakeConnected := uavtalk.CreateGCSTelemetryStatsObjectPacket("Connected")
-				fcInChan <- handshakeConnected
-			}
+	// the objects are enumerated once the telemetry is connected
+	v.telemetry.OnStatusChange(func(status uavtalk.TelemetryStatus) {
+		if status == uavtalk.TelemetryConnected {
+			v.session.Begin()
 		}
+	})
+	v.session.OnComplete(func(sessionID uint16, objects []uavtalk.ActiveObject) {
+		go v.activateObjects(objects)
+	})
+
+	// the handshake starts over each time the link comes up
+	linkHandler := func(i interface{}) bool {
+		state, ok := i.(uavtalk.LinkState)
+		if ok == false {
+			return true
+		}
+		if state == uavtalk.LinkUp {
+			v.values.clear()
+		}
+		v.telemetry.HandleLinkState(state)
+		v.session.HandleLinkState(state)
+		v.transactions.HandleLinkState(state)
+		v.sendEvent(&rotonde.Event{linkEventIdentifier, map[string]interface{}{"status": state.String()}})
 		return true
 	}
 
-	var sessionID uint16
-	var currentObjectID uint8
-	var numberOfObjects uint8
-
-	/**
-	 * TODO: This is getting messy, and the initial object retrieval is not done, but the
-	 * process is still engaged on fc side, resulting in a SESSION_PAUSE seconds pause of the stream,
-	 * which should be avoidable.
-	 */
-
-	var start time.Time
-	var activeDefinitions []*uavtalk.Definition
-	sessionHandler := func(i interface{}) bool {
-		p := i.(uavtalk.Packet)
-		if p.Definition == flightTelemetryStats {
-			if !connected && p.Data["Status"] == "Connected" {
-				connected = true
-				sessionManagingReq := uavtalk.CreateSessionManagingRequest()
-				fcInChan <- sessionManagingReq
-			}
-		} else if p.Definition == sessionManaging {
-			if p.Cmd == uavtalk.ObjectCmd || p.Cmd == uavtalk.ObjectCmdWithAck {
-				_numberOfObjects := p.Data["NumberOfObjects"].(uint8)
-				if _numberOfObjects != 0 {
-					numberOfObjects = _numberOfObjects
-				}
-				if p.Cmd == uavtalk.ObjectCmdWithAck {
-					sessionManagingPacketAck := uavtalk.CreatePacketAck(p.Definition)
-					fcInChan <- sessionManagingPacketAck
-
-					objectID := p.Data["ObjectID"].(uint32)
-					if objectID != 0 {
-						definition, err := uavtalk.AllDefinitions.GetDefinitionForObjectID(objectID)
-						if err != nil {
-							log.Warning(err)
-						} else {
-							// TODO create rotonde definition
-							activeDefinitions = append(activeDefinitions, definition)
-						}
-					}
-
-					if currentObjectID >= numberOfObjects {
-						sessionID = sessionID
-						log.Info("Available Definitions fetch done.")
-						spent := time.Now().Sub(start).Seconds()
-						go func() {
-							meta := map[string]interface{}{
-								"modes": float64(0), "periodFlight": float64(0), "periodGCS": float64(0), "periodLog": float64(0),
-							}
-							if spent < SESSION_PAUSE {
-								time.Sleep(time.Duration(float64(SESSION_PAUSE)-spent) * time.Second)
-							}
-							for _, definition := range activeDefinitions {
-								modes := 0
-								log.Info("sending definition", definition.Name)
-
-								if definition.TelemetryFlight.Acked {
-									modes |= 1 << 2
-								}
-								if definition.TelemetryGcs.Acked {
-									modes |= 1 << 3
-								}
-
-								meta["modes"] = float64(modes)
-
-								setter := uavtalk.CreateObjectSetter(definition.Meta.Name, 0, meta)
-								fcInChan <- *setter
-								time.Sleep(50 * time.Millisecond)
-							}
-
-							for _, definition := range activeDefinitions {
-								log.Info("sending definition", definition.Name)
-								sendAsRotondeDefinitions(definition, client)
-								sendAsRotondeDefinitions(definition.Meta, client)
-							}
-						}()
-
-						return true
-					}
-
-					if currentObjectID == 0 {
-						sessionID = uint16(time.Now().Unix())
-						log.Info("Creating session ", sessionID)
-					}
-					sessionManagingPacket := uavtalk.CreateSessionManagingPacket(sessionID, currentObjectID)
-					currentObjectID++
-					fcInChan <- sessionManagingPacket
-				} else {
-					_sessionID := p.Data["SessionID"].(uint16)
-					// partial and bad session recovery
-					log.Info("got sessionID ", _sessionID)
-					if sessionID != 0 && sessionID == _sessionID {
-						log.Info("Recovering ", sessionID)
-						return true
-					}
-					start = time.Now()
-					sessionManagingPacket := uavtalk.CreateSessionManagingPacket(0, 0)
-					fcInChan <- sessionManagingPacket
-					activeDefinitions = make([]*uavtalk.Definition, 0, 100)
-				}
-			} else if p.Cmd == uavtalk.ObjectAck {
-				log.Info("Received Ack for SessionManaging")
-			} else if p.Cmd == uavtalk.ObjectNack {
-				log.Info("Received Nack for SessionManaging")
-			}
+	packetHandler := func(i interface{}) bool {
+		if p, ok := i.(uavtalk.Packet); ok {
+			v.telemetry.HandlePacket(p)
+			v.session.HandlePacket(p)
 		}
 		return true
 	}
 
 	auth := handlers.NewHandlerManager(root.NewOutChan(10), filter, handlers.Noop, handlers.Noop)
-	auth.Attach(disconnectedHandler)
-	auth.Attach(sessionHandler)
+	auth.Attach(linkHandler)
+	auth.Attach(packetHandler)
 	return auth
 }
 
-func initStreamHandlers(root *handlers.HandlerManager, fcInChan chan uavtalk.Packet, client *client.Client) *handlers.HandlerManager {
+// activateObjects exposes the active objects to rotonde, then sets their telemetry modes,
+// one meta object at a time, each write waits for the ack of the previous one,
+// they are refused when the definitions do not match the firmware
+func (v *Vehicle) activateObjects(objects []uavtalk.ActiveObject) {
+	set := v.connection.Registry().UAVOHash()
+	for _, object := range objects {
+		log.Infof("%s: %s, %d instances", v.Name, object.Definition.Name, object.Instances)
+		v.definitions.addUAVTalkDefinition(set, object.Definition)
+		v.definitions.addUAVTalkDefinition(set, object.Definition.Meta)
+	}
 
-	objectPersistenceDefinition, err := uavtalk.AllDefinitions.GetDefinitionForName("ObjectPersistence")
-	if err != nil {
+	for _, object := range objects {
+		modes := 0
+		if object.Definition.TelemetryFlight.Acked {
+			modes |= 1 << 2
+		}
+		if object.Definition.TelemetryGcs.Acked {
+			modes |= 1 << 3
+		}
+		meta := map[string]interface{}{
+			"modes": float64(modes), "periodFlight": float64(0), "periodGCS": float64(0), "periodLog": float64(0),
+		}
+
+		setter := uavtalk.NewPacket(object.Definition.Meta, uavtalk.ObjectCmdWithAck, 0, meta)
+		transaction, err := v.transactions.Send(setter, nil)
+		if err != nil {
+			log.Warning(err)
+			return
+		}
+		if result := transaction.Wait(); result.Status != uavtalk.TransactionAcked {
+			log.Warningf("%s: %s not set: %s", v.Name, object.Definition.Meta.Name, result.Err)
+		}
+	}
+}
+
+func (v *Vehicle) initStreamHandlers(root *handlers.HandlerManager) *handlers.HandlerManager {
+	if _, err := v.connection.Registry().GetDefinitionForName("ObjectPersistence"); err != nil {
 		log.Fatal(err)
 	}
 
 	filter := func(i interface{}) (interface{}, bool) {
-		p := i.(uavtalk.Packet)
-		return i, authPackets.contains(p.Definition.Name) == false
+		p, ok := i.(uavtalk.Packet)
+		return i, ok && authPackets.contains(p.Definition.Name) == false
 	}
 
 	handler := func(i interface{}) bool {
 		p := i.(uavtalk.Packet)
+		if p.Cmd == uavtalk.ObjectCmd || p.Cmd == uavtalk.ObjectCmdWithAck {
+			v.values.set(p.Definition.Name, p.InstanceID, p.Data)
+		}
 		if p.Cmd == uavtalk.ObjectCmdWithAck {
-			fcInChan <- uavtalk.CreatePacketAck(p.Definition)
-		} else if p.Cmd == uavtalk.ObjectAck {
-			// send ObjectPersistence when received a Ack for object with Settings == true
-			if p.Definition != objectPersistenceDefinition && p.Definition.Settings == true {
-				fcInChan <- uavtalk.CreatePersistObject(p.Definition, p.InstanceID)
+			if err := v.connection.Send(uavtalk.CreatePacketAck(p.Definition)); err != nil {
+				log.Warningf("%s: ack not sent: %s", v.Name, err)
 			}
 		}
+		v.transactions.HandlePacket(p)
+		v.persistWaiters.handle(p)
 		if event := toRotondePacket(p); event != nil {
-			client.SendMessage(event)
+			v.sendEvent(event)
 		}
 		return true
 	}
@@ -218,52 +167,186 @@ func initStreamHandlers(root *handlers.HandlerManager, fcInChan chan uavtalk.Pac
 // main
 
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal(fmt.Sprintf("Usage: %s common_directory/", os.Args[0]))
+	if len(os.Args) > 1 && os.Args[1] == lintCommand {
+		os.Exit(lint(os.Args[2:]))
+	}
+
+	var vehicleFlags vehicleFlagList
+	linkURI := flag.String("link", uavtalk.DefaultLinkURI, "flight controller link, eg. hid://?board=sparky2, tcp://host:port, tcp://:9000?mode=listen, udp://:9000, serial:///dev/ttyUSB0?baud=57600, replay://flight.opl, sim://")
+	flag.Var(&vehicleFlags, "vehicle", "name=uri, adds a vehicle reachable by the given link, can be repeated, overrides -link")
+	definitionSet := flag.String("definitions", "", fmt.Sprintf("bundled definition set to use instead of a definitions directory, one of %v", uavtalk.DefinitionSets()))
+	libraryDir := flag.String("library", "", "directory of definition sets, one per sub directory, the one matching the firmware is used")
+	sessionCacheDir := flag.String("session-cache", filepath.Join(os.TempDir(), "rotonde-uavtalk-sessions"), "directory where the objects of the flight controller sessions are kept, empty to disable")
+	listUSB := flag.Bool("list-usb", false, "list the supported boards plugged on USB and exit")
+	flag.Parse()
+
+	if *listUSB {
+		devices, err := uavtalk.EnumerateUSBDevices()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, device := range devices {
+			fmt.Println(device)
+		}
+		return
 	}
 
-	fcInChan := make(chan uavtalk.Packet, 100)
-	fcOutChan := make(chan uavtalk.Packet, 100)
+	if len(vehicleFlags) == 0 {
+		vehicleFlags = append(vehicleFlags, vehicleFlag{defaultVehicleName, *linkURI})
+	}
 
 	client := client.NewClient("ws://127.0.0.1:4224")
+	definitions := newRotondeDefinitions(client)
+
+	registry, err := loadRegistry(*definitionSet)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	library, err := loadLibrary(registry, *libraryDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var sessionCache *uavtalk.SessionCache
+	if *sessionCacheDir != "" {
+		sessionCache = uavtalk.NewSessionCache(*sessionCacheDir)
+	}
+
+	vehicles := Vehicles{}
+	for _, vehicleFlag := range vehicleFlags {
+		vehicles[vehicleFlag.name] = NewVehicle(vehicleFlag.name, vehicleFlag.linkURI, registry, library, sessionCache, client, definitions)
+	}
+
 	client.OnAction(func(i interface{}) bool {
-		if p := toUAVTalkPacket(i); p != nil {
-			fcInChan <- *p
+		action, ok := i.(rotonde.Action)
+		if ok == false {
+			return true
 		}
+		vehicle, err := vehicles.forAction(action)
+		if err != nil {
+			log.Warning(err)
+			return true
+		}
+		vehicle.handleAction(action)
 		return true
 	})
 
-	uavtalk.LoadDefinitions(os.Args[1])
-	go uavtalk.Start(fcInChan, fcOutChan)
-	rootOut := handlers.NewHandlerManager(chanCast(fcOutChan), handlers.PassAll, handlers.Noop, handlers.Noop)
-	initAuthHandlers(rootOut, fcInChan, client)
-	initStreamHandlers(rootOut, fcInChan, client)
+	definitions.addLinkDefinition()
+	for _, vehicle := range vehicles {
+		vehicle.Start()
+	}
 
 	select {}
 }
 
 // utils
 
-func chanCast(inChan chan uavtalk.Packet) chan interface{} {
+// loadRegistry loads the definitions directory given as argument, or a bundled definition set
+func loadRegistry(definitionSet string) (*uavtalk.Registry, error) {
+	if flag.NArg() > 0 {
+		return uavtalk.LoadRegistry(flag.Arg(0))
+	}
+	if definitionSet != "" {
+		return uavtalk.LoadDefinitionSet(definitionSet)
+	}
+	return nil, fmt.Errorf("No definitions\nUsage: %s [-link uri | -vehicle name=uri ...] [-library dir] [-definitions set | definitions_directory]", os.Args[0])
+}
+
+// loadLibrary gathers the definitions the firmware can be matched with: the default ones, the bundled ones and the library directory
+func loadLibrary(registry *uavtalk.Registry, dir string) (*uavtalk.Library, error) {
+	library := uavtalk.NewLibrary()
+	library.Add("default", registry)
+
+	for _, name := range uavtalk.DefinitionSets() {
+		bundled, err := uavtalk.LoadDefinitionSet(name)
+		if err != nil {
+			return nil, err
+		}
+		if bundled.UAVOHash() != registry.UAVOHash() {
+			library.Add(name, bundled)
+		}
+	}
+
+	if dir != "" {
+		if err := library.AddDirectory(dir); err != nil {
+			return nil, err
+		}
+	}
+	return library, nil
+}
+
+// chanCast merges packets and link state changes in a single chan for the handlers
+func chanCast(inChan chan uavtalk.Packet, stateChan chan uavtalk.LinkState) chan interface{} {
 	outChan := make(chan interface{})
 
 	go func() {
 		defer close(outChan)
-		for i := range inChan {
-			outChan <- i
+		for {
+			select {
+			case p, ok := <-inChan:
+				if ok == false {
+					return
+				}
+				outChan <- p
+			case state := <-stateChan:
+				outChan <- state
+			}
 		}
 	}()
 	return outChan
 }
 
-func sendAsRotondeDefinitions(definition *uavtalk.Definition, client *client.Client) {
+// rotondeDefinitions publishes definitions to rotonde, once per definition set,
+// vehicles running the same firmware share them, a vehicle running another firmware publishes its own
+type rotondeDefinitions struct {
+	client *client.Client
+
+	mutex     sync.Mutex
+	published map[publishedDefinition]bool
+}
+
+// publishedDefinition keys the definitions published, the link definition belongs to no set (zero hash)
+type publishedDefinition struct {
+	set        uavtalk.UAVOHash
+	identifier string
+}
+
+func newRotondeDefinitions(client *client.Client) *rotondeDefinitions {
+	return &rotondeDefinitions{client: client, published: map[publishedDefinition]bool{}}
+}
+
+// add publishes the definition of the given set, adding the vehicle field
+func (d *rotondeDefinitions) add(set uavtalk.UAVOHash, definition *rotonde.Definition) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := publishedDefinition{set, definition.Identifier}
+	if d.published[key] {
+		return
+	}
+	d.published[key] = true
+
+	definition.PushField(vehicleField, "string", "")
+	d.client.AddLocalDefinition(definition)
+}
+
+// addLinkDefinition exposes the event sent on each link state change, with status "up" or "down"
+func (d *rotondeDefinitions) addLinkDefinition() {
+	event := rotonde.Definition{linkEventIdentifier, "event", false, []*rotonde.FieldDefinition{}}
+	event.PushField("status", "string", "")
+	d.add(uavtalk.UAVOHash{}, &event)
+}
+
+// addUAVTalkDefinition exposes the actions and events of an object of the given definition set
+func (d *rotondeDefinitions) addUAVTalkDefinition(set uavtalk.UAVOHash, definition *uavtalk.Definition) {
 	name := strings.ToUpper(definition.Name)
 
 	getter := rotonde.Definition{fmt.Sprintf("GET_%s", name), "action", false, []*rotonde.FieldDefinition{}}
 	if definition.SingleInstance == false {
 		getter.PushField("index", "number", "")
 	}
-	client.AddLocalDefinition(&getter)
+	d.add(set, &getter)
 
 	setter := rotonde.Definition{fmt.Sprintf("SET_%s", name), "action", false, []*rotonde.FieldDefinition{}}
 	if definition.SingleInstance == false {
@@ -272,7 +355,17 @@ func sendAsRotondeDefinitions(definition *uavtalk.Definition, client *client.Cli
 	for _, field := range definition.Fields {
 		setter.PushField(field.Name, field.Type, field.Units)
 	}
-	client.AddLocalDefinition(&setter)
+	setter.PushField(requestIDField, "string", "")
+	d.add(set, &setter)
+
+	result := rotonde.Definition{resultIdentifier(definition.Name), "event", false, []*rotonde.FieldDefinition{}}
+	if definition.SingleInstance == false {
+		result.PushField("index", "number", "")
+	}
+	result.PushField("status", "string", "")
+	result.PushField(requestIDField, "string", "")
+	result.PushField("error", "string", "")
+	d.add(set, &result)
 
 	update := rotonde.Definition{name, "event", false, []*rotonde.FieldDefinition{}}
 	if definition.SingleInstance == false {
@@ -281,28 +374,31 @@ func sendAsRotondeDefinitions(definition *uavtalk.Definition, client *client.Cli
 	for _, field := range definition.Fields {
 		update.PushField(field.Name, field.Type, field.Units)
 	}
-	client.AddLocalDefinition(&update)
+	update.PushField(timestampField, "number", "ms")
+	d.add(set, &update)
 }
 
-func toRotondePacket(p uavtalk.Packet) interface{} {
+func toRotondePacket(p uavtalk.Packet) *rotonde.Event {
 	if p.Cmd != uavtalk.ObjectCmd && p.Cmd != uavtalk.ObjectCmdWithAck {
 		return nil
 	}
 	name := strings.ToUpper(p.Definition.Name)
 	event := rotonde.Event{name, p.Data}
-	return event
+	if p.Timestamped {
+		event.Data[timestampField] = float64(p.Timestamp)
+	}
+	return &event
 }
 
-func toUAVTalkPacket(i interface{}) *uavtalk.Packet {
-	action, ok := i.(rotonde.Action)
-	if ok == false {
+func toUAVTalkPacket(registry *uavtalk.Registry, action rotonde.Action) *uavtalk.Packet {
+	if len(action.Identifier) < 4 {
 		return nil
 	}
-
 	name := action.Identifier[4:]
-	definition, err := uavtalk.AllDefinitions.GetDefinitionForName(name)
+	definition, err := registry.GetDefinitionForName(name)
 	if err != nil {
-		log.Fatal(err)
+		log.Warning(err)
+		return nil
 	}
 
 	var data map[string]interface{}
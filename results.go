@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	"github.com/HackerLoop/rotonde/shared"
+)
+
+/**
+ * The outcome of each SET_<OBJECT> action is reported by SET_<OBJECT>_RESULT events, with the status:
+ *	refused: not written, the link is down, the definitions do not match the firmware, or a value is not valid
+ *	sent: written, the object is not acked, so nothing more is known
+ *	acked, nacked, timeout: the answer of the flight controller
+ *	persisted, persist_failed: settings objects are then saved to flash, reported by a second event
+ * The requestID field of the action, if any, is given back in its result events, along with the index of
+ * multi instance objects.
+ */
+
+const requestIDField = "requestID"
+
+// the flight controller reports the end of the ObjectPersistence operations with ObjectPersistence updates
+const persistTimeout = 5 * time.Second
+
+// write statuses
+const (
+	writeRefused       = "refused"
+	writeSent          = "sent"
+	writePersisted     = "persisted"
+	writePersistFailed = "persist_failed"
+)
+
+func resultIdentifier(name string) string {
+	return fmt.Sprintf("SET_%s_RESULT", strings.ToUpper(name))
+}
+
+// writeResult reports the outcome of a SET_ action
+type writeResult struct {
+	vehicle    *Vehicle
+	identifier string
+	requestID  interface{}
+	index      interface{}
+}
+
+// newWriteResult takes the requestID out of the action data
+func newWriteResult(v *Vehicle, action rotonde.Action) *writeResult {
+	result := &writeResult{
+		vehicle:    v,
+		identifier: resultIdentifier(action.Identifier[len("SET_"):]),
+		requestID:  action.Data[requestIDField],
+		index:      action.Data["index"],
+	}
+	delete(action.Data, requestIDField)
+	return result
+}
+
+func (r *writeResult) send(status string, err error) {
+	data := map[string]interface{}{"status": status}
+	if r.requestID != nil {
+		data[requestIDField] = r.requestID
+	}
+	if r.index != nil {
+		data["index"] = r.index
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	r.vehicle.sendEvent(&rotonde.Event{r.identifier, data})
+}
+
+type persistKey struct {
+	objectID   uint32
+	instanceID uint32
+}
+
+type persistWaiter struct {
+	key      persistKey
+	callback func(err error)
+	timer    *time.Timer
+}
+
+// persistWaiters waits for the end of ObjectPersistence operations, safe for concurrent use
+type persistWaiters struct {
+	mutex   sync.Mutex
+	waiters map[persistKey][]*persistWaiter
+}
+
+func newPersistWaiters() *persistWaiters {
+	return &persistWaiters{waiters: map[persistKey][]*persistWaiter{}}
+}
+
+// wait calls callback once the flight controller reports the operation on the object is over,
+// with an error if it failed or was not reported in time
+func (w *persistWaiters) wait(definition *uavtalk.Definition, instanceID uint16, callback func(err error)) *persistWaiter {
+	waiter := &persistWaiter{key: persistKey{definition.ObjectID, uint32(instanceID)}, callback: callback}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.waiters[waiter.key] = append(w.waiters[waiter.key], waiter)
+	waiter.timer = time.AfterFunc(persistTimeout, func() {
+		w.resolve(waiter, fmt.Errorf("%s: no ObjectPersistence report", definition.Name))
+	})
+	return waiter
+}
+
+// resolve ends a wait, if it is not already over
+func (w *persistWaiters) resolve(waiter *persistWaiter, err error) {
+	w.mutex.Lock()
+	found := false
+	waiters := w.waiters[waiter.key]
+	for i, other := range waiters {
+		if other == waiter {
+			w.waiters[waiter.key] = append(waiters[:i:i], waiters[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if len(w.waiters[waiter.key]) == 0 {
+		delete(w.waiters, waiter.key)
+	}
+	w.mutex.Unlock()
+
+	if found {
+		waiter.timer.Stop()
+		waiter.callback(err)
+	}
+}
+
+// handle takes the ObjectPersistence updates of the flight controller
+func (w *persistWaiters) handle(p uavtalk.Packet) {
+	if p.Definition.Name != "ObjectPersistence" || (p.Cmd != uavtalk.ObjectCmd && p.Cmd != uavtalk.ObjectCmdWithAck) {
+		return
+	}
+
+	var err error
+	switch p.Data["Operation"] {
+	case "Completed":
+	case "Error":
+		err = fmt.Errorf("the flight controller reported an error")
+	default:
+		return
+	}
+
+	objectID, _ := p.Data["ObjectID"].(uint32)
+	instanceID, _ := p.Data["InstanceID"].(uint32)
+	w.mutex.Lock()
+	waiters := w.waiters[persistKey{objectID, instanceID}]
+	w.mutex.Unlock()
+
+	for _, waiter := range waiters {
+		w.resolve(waiter, err)
+	}
+}
@@ -0,0 +1,186 @@
+package uavtalk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * Capture layer, records everything read from and written to a link, so protocol problems can be reproduced offline.
+ * Capture files start with the captureMagic and the wall clock time (unix nanoseconds, int64) the file was created at,
+ * followed by records:
+ *	int64  nanoseconds since the file was created (monotonic)
+ *	uint8  direction, CaptureRx (from the controller) or CaptureTx (to the controller)
+ *	uint32 data length
+ *	data
+ * All values are little endian. Captures can be replayed with the replay link.
+ * An existing file is appended to, starting with a new header, so a reconnecting link does not overwrite its previous capture.
+ * The records are buffered, and flushed at most captureFlushPeriod after being recorded, on rotation, and on Close.
+ */
+
+const captureMagic = "UAVTCAP1"
+const captureFlushPeriod = 1 * time.Second
+
+// Capture directions
+const (
+	CaptureRx = 0
+	CaptureTx = 1
+)
+
+// CaptureConfig holds the settings of a capture, files are rotated when MaxSize or MaxAge is reached (0 disables)
+type CaptureConfig struct {
+	Path    string
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+type captureLink struct {
+	Linker
+	config CaptureConfig
+
+	mutex   sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	created time.Time
+	size    int64
+	flusher *time.Timer // armed while records wait in writer
+}
+
+var _ Linker = (*captureLink)(nil)
+
+// NewCaptureLink wraps link, recording all its traffic
+func NewCaptureLink(link Linker, config CaptureConfig) (Linker, error) {
+	l := &captureLink{Linker: link, config: config}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// fileName timestamps the file name when rotation is enabled, eg. capture.bin becomes capture-20160106-185800.123.bin
+func (l *captureLink) fileName(now time.Time) string {
+	if l.config.MaxSize == 0 && l.config.MaxAge == 0 {
+		return l.config.Path
+	}
+	ext := filepath.Ext(l.config.Path)
+	base := strings.TrimSuffix(l.config.Path, ext)
+	return fmt.Sprintf("%s-%s%s", base, now.Format("20060102-150405.000"), ext)
+}
+
+func (l *captureLink) open() error {
+	now := time.Now()
+	file, err := os.OpenFile(l.fileName(now), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString(captureMagic)
+	if err := binary.Write(writer, binary.LittleEndian, now.UnixNano()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file, l.writer, l.created, l.size = file, writer, now, info.Size()+int64(len(captureMagic)+8)
+	log.Infof("Capturing link traffic to %s", file.Name())
+	return nil
+}
+
+func (l *captureLink) closeFile() {
+	if l.file != nil {
+		l.writer.Flush()
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *captureLink) record(direction uint8, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	if (l.config.MaxSize > 0 && l.size >= l.config.MaxSize) || (l.config.MaxAge > 0 && time.Since(l.created) >= l.config.MaxAge) {
+		l.closeFile()
+		if err := l.open(); err != nil {
+			log.Warningf("Capture stopped: %s", err)
+			return
+		}
+	}
+
+	header := make([]byte, 13)
+	binary.LittleEndian.PutUint64(header[0:8], uint64(time.Since(l.created)))
+	header[8] = direction
+	binary.LittleEndian.PutUint32(header[9:13], uint32(len(data)))
+	l.writer.Write(header)
+	if _, err := l.writer.Write(data); err != nil {
+		l.stop(err)
+		return
+	}
+	l.size += int64(len(header) + len(data))
+
+	if l.flusher == nil {
+		l.flusher = time.AfterFunc(captureFlushPeriod, l.flush)
+	}
+}
+
+func (l *captureLink) flush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.flusher = nil
+	if l.file == nil {
+		return
+	}
+	if err := l.writer.Flush(); err != nil {
+		l.stop(err)
+	}
+}
+
+// stop stops the capture after a write error, the link itself is fine, the mutex has to be held
+func (l *captureLink) stop(err error) {
+	log.Warningf("Capture stopped: %s", err)
+	l.closeFile()
+}
+
+func (l *captureLink) Read(b []byte) (int, error) {
+	n, err := l.Linker.Read(b)
+	l.record(CaptureRx, b[:n])
+	return n, err
+}
+
+func (l *captureLink) Write(b []byte) (int, error) {
+	n, err := l.Linker.Write(b)
+	l.record(CaptureTx, b[:n])
+	return n, err
+}
+
+func (l *captureLink) Close() error {
+	l.mutex.Lock()
+	l.closeFile()
+	l.mutex.Unlock()
+	return l.Linker.Close()
+}
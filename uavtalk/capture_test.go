@@ -0,0 +1,215 @@
+package uavtalk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type captureRecord struct {
+	offset    time.Duration
+	direction uint8
+	data      string
+}
+
+// capture is a capture file read back, one header per capture appended to the file
+type capture struct {
+	created []time.Time
+	records [][]captureRecord
+}
+
+func readCapture(t *testing.T, path string) capture {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result capture
+	reader := bytes.NewReader(content)
+	for reader.Len() > 0 {
+		magic := make([]byte, len(captureMagic))
+		if _, err := io.ReadFull(reader, magic); err != nil {
+			t.Fatal(err)
+		}
+		if string(magic) == captureMagic {
+			var created int64
+			if err := binary.Read(reader, binary.LittleEndian, &created); err != nil {
+				t.Fatal(err)
+			}
+			result.created = append(result.created, time.Unix(0, created))
+			result.records = append(result.records, nil)
+			continue
+		}
+		if len(result.created) == 0 {
+			t.Fatalf("%s: no capture header", path)
+		}
+		reader.Seek(-int64(len(magic)), 1)
+
+		var record struct {
+			Offset    int64
+			Direction uint8
+			Size      uint32
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &record); err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, record.Size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			t.Fatal(err)
+		}
+		last := len(result.records) - 1
+		result.records[last] = append(result.records[last], captureRecord{time.Duration(record.Offset), record.Direction, string(data)})
+	}
+	return result
+}
+
+// captureTraffic writes and reads a captured link, what is read is read back in chunks of 5 bytes
+func captureTraffic(t *testing.T, config CaptureConfig, written string, read string) {
+	link, err := NewCaptureLink(&bufferLink{reads: bytes.NewBufferString(read)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	if _, err := link.Write([]byte(written)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 5)
+	for {
+		if _, err := link.Read(buffer); err == io.EOF {
+			break
+		}
+	}
+}
+
+func TestCaptureRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavtalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.bin")
+
+	// a second capture is appended to the file, after a header of its own
+	start := time.Now()
+	captureTraffic(t, CaptureConfig{Path: path}, "sent", "received")
+	captureTraffic(t, CaptureConfig{Path: path}, "again", "")
+
+	result := readCapture(t, path)
+	expected := [][]captureRecord{
+		{{0, CaptureTx, "sent"}, {0, CaptureRx, "recei"}, {0, CaptureRx, "ved"}},
+		{{0, CaptureTx, "again"}},
+	}
+	if len(result.created) != len(expected) {
+		t.Fatalf("%d captures, expected %d", len(result.created), len(expected))
+	}
+	for i, records := range result.records {
+		if result.created[i].Before(start.Add(-time.Millisecond)) || result.created[i].After(time.Now()) {
+			t.Errorf("capture %d created at %s, expected after %s", i, result.created[i], start)
+		}
+		if len(records) != len(expected[i]) {
+			t.Errorf("capture %d: %d records, expected %d", i, len(records), len(expected[i]))
+			continue
+		}
+		var last time.Duration
+		for j, record := range records {
+			if record.direction != expected[i][j].direction || record.data != expected[i][j].data {
+				t.Errorf("capture %d record %d: %d %q, expected %d %q", i, j, record.direction, record.data, expected[i][j].direction, expected[i][j].data)
+			}
+			if record.offset < last || record.offset > time.Second {
+				t.Errorf("capture %d record %d at %s, after %s", i, j, record.offset, last)
+			}
+			last = record.offset
+		}
+	}
+}
+
+func TestCaptureFileName(t *testing.T) {
+	now := time.Date(2016, 1, 6, 18, 58, 0, 123000000, time.Local)
+	for _, test := range []struct {
+		config   CaptureConfig
+		expected string
+	}{
+		{CaptureConfig{Path: "capture.bin"}, "capture.bin"},
+		{CaptureConfig{Path: "capture.bin", MaxSize: 1000}, "capture-20160106-185800.123.bin"},
+		{CaptureConfig{Path: "logs/capture", MaxAge: time.Hour}, "logs/capture-20160106-185800.123"},
+	} {
+		l := &captureLink{config: test.config}
+		if name := l.fileName(now); name != test.expected {
+			t.Errorf("%+v: %s, expected %s", test.config, name, test.expected)
+		}
+	}
+}
+
+func TestCaptureRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavtalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name   string
+		config CaptureConfig
+		pause  time.Duration
+	}{
+		// the header is 16 bytes, each record 13 + 5 bytes
+		{"size", CaptureConfig{MaxSize: 16 + 2*18}, 2 * time.Millisecond},
+		{"age", CaptureConfig{MaxAge: 50 * time.Millisecond}, 30 * time.Millisecond},
+	} {
+		test.config.Path = filepath.Join(dir, test.name+".bin")
+		link, err := NewCaptureLink(&bufferLink{reads: bytes.NewBufferString("01234567890123456789")}, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 5)
+		for i := 0; i < 4; i++ {
+			link.Read(buffer)
+			time.Sleep(test.pause)
+		}
+		link.Close()
+
+		files, err := filepath.Glob(filepath.Join(dir, test.name+"-*.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 2 {
+			t.Fatalf("%s: %d files %v, expected 2", test.name, len(files), files)
+		}
+		for i, file := range files {
+			if result := readCapture(t, file); len(result.created) != 1 || len(result.records[0]) != 2 {
+				t.Errorf("%s: file %d holds %d captures, records %v, expected 1 capture of 2 records", test.name, i, len(result.created), result.records)
+			}
+		}
+	}
+}
+
+// the records are flushed without waiting for a rotation or Close
+func TestCaptureFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavtalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.bin")
+
+	link, err := NewCaptureLink(&bufferLink{reads: &bytes.Buffer{}}, CaptureConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+	link.Write([]byte("sent"))
+
+	expected := int64(len(captureMagic) + 8 + 13 + 4)
+	for deadline := time.Now().Add(2 * captureFlushPeriod); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if info, err := os.Stat(path); err == nil && info.Size() == expected {
+			return
+		}
+	}
+	t.Errorf("record not flushed after %s", 2*captureFlushPeriod)
+}
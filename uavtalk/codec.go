@@ -0,0 +1,83 @@
+package uavtalk
+
+import "io"
+
+/**
+ * Streaming codec, to read and write packets on any io.Reader / io.Writer (files, sockets, pipes...),
+ * without the Connection and its goroutines.
+ */
+
+// Decoder reads packets from a byte stream
+type Decoder struct {
+	reader io.Reader
+	parser *Parser
+	buffer []byte
+
+	decoded []decoded // in the order of the stream
+	err     error
+}
+
+// decoded is a packet, or the error of a packet rejected
+type decoded struct {
+	packet *Packet
+	err    error
+}
+
+// NewDecoder creates a decoder reading from reader, packets are decoded with the definitions of registry
+func NewDecoder(reader io.Reader, registry *Registry) *Decoder {
+	return &Decoder{
+		reader: reader,
+		parser: NewParser(registry),
+		buffer: make([]byte, 4096),
+	}
+}
+
+// Parser returns the parser used by the decoder, for its error counters
+func (d *Decoder) Parser() *Parser {
+	return d.parser
+}
+
+// Decode returns the next packet read.
+// A *ParseError is returned for each packet rejected on crc or that could not be decoded, decoding can go on after it,
+// any other error comes from the reader, io.EOF when the stream ended.
+func (d *Decoder) Decode() (*Packet, error) {
+	for {
+		if len(d.decoded) > 0 {
+			next := d.decoded[0]
+			d.decoded = d.decoded[1:]
+			return next.packet, next.err
+		}
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		n, err := d.reader.Read(d.buffer)
+		if n > 0 {
+			d.parser.feed(d.buffer[0:n], func(packet *Packet, err error) {
+				d.decoded = append(d.decoded, decoded{packet, err})
+			})
+		}
+		// what was read along with the error is returned first
+		d.err = err
+	}
+}
+
+// Encoder writes packets to a byte stream
+type Encoder struct {
+	writer io.Writer
+}
+
+// NewEncoder creates an encoder writing to writer
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: writer}
+}
+
+// Encode writes packet, in a single Write
+func (e *Encoder) Encode(packet *Packet) error {
+	binaryPacket, err := packet.toBinary()
+	if err != nil {
+		return err
+	}
+	_, err = e.writer.Write(binaryPacket)
+	return err
+}
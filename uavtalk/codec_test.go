@@ -0,0 +1,55 @@
+package uavtalk
+
+import (
+	"io"
+	"testing"
+)
+
+// the packets and the errors are decoded in the order of the stream
+func TestCodecRoundTrip(t *testing.T) {
+	registry := testRegistry(t)
+	accessory := testDefinition(t, registry, "AccessoryDesired")
+	packets := make([]*Packet, 5)
+	for i := range packets {
+		packets[i] = NewPacket(accessory, ObjectCmd, uint16(i), map[string]interface{}{"AccessoryVal": float64(i)})
+	}
+	badCRC := testFrame(t, packets[0])
+	badCRC[len(badCRC)-1]++
+
+	reader, writer := io.Pipe()
+	go func() {
+		encoder := NewEncoder(writer)
+		encoder.Encode(packets[0])
+		writer.Write(badCRC)
+		encoder.Encode(packets[1])
+		// read at once, the errors still come between their packets
+		writer.Write(concat(testFrame(t, packets[2]), badCRC, testFrame(t, packets[3]), badCRC, badCRC, testFrame(t, packets[4])))
+		writer.Close()
+	}()
+
+	// the instance of the packets expected, -1 for an error
+	expected := []int{0, -1, 1, 2, -1, 3, -1, -1, 4}
+	decoder := NewDecoder(reader, registry)
+	for i, instance := range expected {
+		packet, err := decoder.Decode()
+		if instance < 0 {
+			if _, ok := err.(*ParseError); ok == false {
+				t.Fatalf("decode %d: %v %v, expected a *ParseError", i, packet, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("decode %d: %s, expected instance %d", i, err, instance)
+		}
+		if packet.InstanceID != uint16(instance) || packet.Data["AccessoryVal"] != float32(instance) {
+			t.Errorf("decode %d: instance %d, %v, expected instance %d", i, packet.InstanceID, packet.Data, instance)
+		}
+	}
+
+	if packet, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("decoded %v %v at the end of the stream, expected io.EOF", packet, err)
+	}
+	if errors := decoder.Parser().ErrorCount(StateCRC); errors != 4 {
+		t.Errorf("%d crc errors counted, expected 4", errors)
+	}
+}
@@ -0,0 +1,176 @@
+package uavtalk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * A Connection is the link to one flight controller, along with the definitions used to talk to it,
+ * so a single process can talk to several flight controllers.
+ * When a Library is set, the firmware is identified each time the link comes up,
+ * and the definitions matching its UAVO hash are used (see firmware.go).
+ *
+ * The packets originated by the application go through Send, which refuses to write objects
+ * with definitions which were not verified, as they could corrupt the settings of the firmware.
+ */
+
+var errLinkDown = errors.New("link down")
+var errNotVerified = errors.New("the definitions do not match the firmware")
+var errLinkBusy = errors.New("the link does not keep up")
+
+// LinkStats are the traffic counters of a connection, since it was created
+type LinkStats struct {
+	TxBytes    uint64
+	TxPackets  uint64
+	TxFailures uint64 // packets which could not be encoded or written, or were dropped while the link was down
+	TxRetries  uint64 // packets sent again, as they were not acknowledged in time
+	RxBytes    uint64
+	RxPackets  uint64
+	RxFailures uint64 // parsing errors
+}
+
+// Connection to a flight controller
+type Connection struct {
+	// first, atomic counters have to be 64 bit aligned
+	txBytes    uint64
+	txPackets  uint64
+	txFailures uint64
+	txRetries  uint64
+	rxBytes    uint64
+
+	LinkURI string
+	Library *Library // definitions to pick from, nil to always use the registry given to NewConnection
+
+	InChan    chan Packet    // packets to the controller
+	OutChan   chan Packet    // packets from the controller
+	StateChan chan LinkState // link state changes, has to be consumed
+
+	Parser *Parser // reassembles the packets read from the link, holds the parsing error counters
+
+	defaultRegistry *Registry
+
+	mutex        sync.RWMutex
+	registry     *Registry
+	verified     bool
+	firmwareHash UAVOHash
+	up           bool
+}
+
+// NewConnection creates a connection, nothing happens until Start is called
+func NewConnection(linkURI string, registry *Registry) *Connection {
+	return &Connection{
+		LinkURI:         linkURI,
+		InChan:          make(chan Packet, 100),
+		OutChan:         make(chan Packet, 100),
+		StateChan:       make(chan LinkState, 10),
+		Parser:          NewParser(registry),
+		defaultRegistry: registry,
+		registry:        registry,
+		verified:        true,
+	}
+}
+
+// Registry returns the definitions in use, they can change each time the link comes up
+func (c *Connection) Registry() *Registry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.registry
+}
+
+// Verified is false when the definitions in use do not match the firmware, writes to the controller should be refused
+func (c *Connection) Verified() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.verified
+}
+
+// Up is true while the link is up, what is sent to InChan while it is down is dropped
+func (c *Connection) Up() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.up
+}
+
+func (c *Connection) setUp(up bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.up = up
+}
+
+// CheckSend returns why Send would refuse packet, nil if it would not, the link may still not keep up
+func (c *Connection) CheckSend(packet Packet) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.up == false {
+		return fmt.Errorf("%s: %s", packet.Definition.Name, errLinkDown)
+	}
+	if (packet.Cmd == ObjectCmd || packet.Cmd == ObjectCmdWithAck) && c.verified == false {
+		return fmt.Errorf("%s: %s", packet.Definition.Name, errNotVerified)
+	}
+	return nil
+}
+
+// Send queues a packet to the controller without blocking, see CheckSend, packets are also refused when InChan is full
+func (c *Connection) Send(packet Packet) error {
+	if err := c.CheckSend(packet); err != nil {
+		return err
+	}
+	select {
+	case c.InChan <- packet:
+		return nil
+	default:
+		return fmt.Errorf("%s: %s", packet.Definition.Name, errLinkBusy)
+	}
+}
+
+// FirmwareUAVOHash returns the UAVO hash reported by the firmware, zero if it was not identified
+func (c *Connection) FirmwareUAVOHash() UAVOHash {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.firmwareHash
+}
+
+func (c *Connection) setRegistry(registry *Registry, verified bool, firmwareHash UAVOHash) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.registry = registry
+	c.verified = verified
+	c.firmwareHash = firmwareHash
+}
+
+// Stats returns the traffic counters, received packets and parsing errors are counted by the Parser
+func (c *Connection) Stats() LinkStats {
+	stats := LinkStats{
+		TxBytes:    atomic.LoadUint64(&c.txBytes),
+		TxPackets:  atomic.LoadUint64(&c.txPackets),
+		TxFailures: atomic.LoadUint64(&c.txFailures),
+		TxRetries:  atomic.LoadUint64(&c.txRetries),
+		RxBytes:    atomic.LoadUint64(&c.rxBytes),
+		RxPackets:  c.Parser.PacketCount(),
+	}
+	for _, count := range c.Parser.ErrorCounts() {
+		stats.RxFailures += count
+	}
+	return stats
+}
+
+// Start runs the connection, (re)opening the link each time it fails, it never returns
+func (c *Connection) Start() {
+	registry := c.Registry()
+	log.Infof("%s: %d definitions loaded, maxUAVObjectLength: %d", c.LinkURI, registry.Len(), registry.MaxUAVObjectLength())
+
+	for {
+		c.run()
+	}
+}
+
+// countRetry counts a packet sent again
+func (c *Connection) countRetry() {
+	atomic.AddUint64(&c.txRetries, 1)
+}
@@ -0,0 +1,58 @@
+package uavtalk
+
+import (
+	"testing"
+	"time"
+)
+
+// objects are not written with definitions which do not match the firmware, requests are still sent
+func TestConnectionUnverified(t *testing.T) {
+	registry := testRegistry(t)
+	definition := testDefinition(t, registry, "AccessoryDesired")
+	uri, links := newTestLinks()
+	connection := NewConnection(uri, registry)
+	transactions := NewTransactions(connection)
+	go connection.Start()
+
+	link := newTestLink(false)
+	links <- link
+	waitLinkState(t, connection, LinkUp)
+	connection.setRegistry(registry, false, UAVOHash{})
+
+	data := map[string]interface{}{"AccessoryVal": float64(1)}
+	if err := connection.Send(*NewPacket(definition, ObjectCmd, 0, data)); err == nil {
+		t.Error("ObjectCmd sent with definitions not verified")
+	}
+	if _, err := transactions.Send(NewPacket(definition, ObjectCmdWithAck, 0, data), nil); err == nil {
+		t.Error("ObjectCmdWithAck sent with definitions not verified")
+	}
+	persist, err := registry.CreatePersistObject(definition, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transactions.Send(&persist, nil); err == nil {
+		t.Error("ObjectPersistence sent with definitions not verified")
+	}
+	select {
+	case frame := <-link.writes:
+		t.Errorf("% x written with definitions not verified", frame)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	request := NewPacket(definition, ObjectRequest, 0, map[string]interface{}{})
+	if _, err := transactions.Send(request, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case frame := <-link.writes:
+		if expected := testFrame(t, request); string(frame) != string(expected) {
+			t.Errorf("% x written, expected the request % x", frame, expected)
+		}
+	case <-time.After(time.Second):
+		t.Error("request not sent")
+	}
+
+	close(link.fail)
+	waitLinkState(t, connection, LinkDown)
+	transactions.HandleLinkState(LinkDown)
+}
@@ -46,6 +46,21 @@ func (definitions Definitions) IsUniqueInstanceForObjectID(objectID uint32) (boo
 	return definition.SingleInstance, nil
 }
 
+// MaxUAVObjectLength returns the length of the biggest packet, header included
+func (definitions Definitions) MaxUAVObjectLength() int {
+	maxLength := 0
+	for _, definition := range definitions {
+		length := definition.Fields.ByteLength() + shortHeaderLength
+		if definition.SingleInstance == false {
+			length += 2
+		}
+		if length > maxLength {
+			maxLength = length
+		}
+	}
+	return maxLength
+}
+
 // FieldTypeInfo Taulabs defines its fields as type names, with a given size implicitely implied
 type FieldTypeInfo struct {
 	Index int
@@ -126,6 +141,11 @@ type FieldDefinition struct {
 	OptionsAttr      string   `xml:"options,attr" json:"-"`
 	Options          []string `xml:"options>option" json:"options"`
 	DefaultValue     string   `xml:"defaultvalue,attr" json:"defaultValue"`
+	LimitsAttr       string   `xml:"limits,attr" json:"-"`
+	LimitsElement    string   `xml:"limits" json:"-"`
+
+	Defaults []interface{} `xml:"-" json:"defaults"` // per element, float64, or string for enums
+	Limits   [][]*Limit    `xml:"-" json:"limits"`   // per element, elements without limits may be missing at the end
 
 	CloneOf string `xml:"cloneof,attr" json:"cloneOf"`
 }
@@ -195,6 +215,13 @@ func (definition *Definition) fieldProcess() error {
 		if err != nil {
 			return err
 		}
+
+		if err := field.parseDefaults(); err != nil {
+			return err
+		}
+		if err := field.parseLimits(); err != nil {
+			return err
+		}
 	}
 
 	// create clones
@@ -204,6 +231,9 @@ func (definition *Definition) fieldProcess() error {
 			if err != nil {
 				return err
 			}
+			if len(clonedField.CloneOf) != 0 {
+				return fmt.Errorf("%s is a clone of %s, which is a clone itself", field.Name, field.CloneOf)
+			}
 			name, cloneOf := field.Name, field.CloneOf
 			*field = *clonedField
 			field.Name, field.CloneOf = name, cloneOf
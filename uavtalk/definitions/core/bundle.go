@@ -0,0 +1,17 @@
+// Code generated by uavobjbundle; DO NOT EDIT.
+
+package core
+
+import "github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+
+func init() {
+	uavtalk.RegisterDefinitionSet("core", uavtalk.DefinitionFiles{
+		"accessorydesired.xml":     []byte("<xml>\n    <object name=\"AccessoryDesired\" singleinstance=\"false\" settings=\"false\" category=\"Control\">\n        <description>Desired Auxillary actuator settings.</description>\n        <field name=\"AccessoryVal\" units=\"%\" type=\"float\" elements=\"1\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"false\" updatemode=\"onchange\" period=\"0\"/>\n        <telemetryflight acked=\"false\" updatemode=\"periodic\" period=\"1000\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+		"attitudeactual.xml":       []byte("<xml>\n    <object name=\"AttitudeActual\" singleinstance=\"true\" settings=\"false\" category=\"State\">\n        <description>The updated Attitude estimation from @ref AHRSCommsModule.</description>\n        <field name=\"q1\" units=\"\" type=\"float\" elements=\"1\"/>\n        <field name=\"q2\" units=\"\" type=\"float\" elements=\"1\"/>\n        <field name=\"q3\" units=\"\" type=\"float\" elements=\"1\"/>\n        <field name=\"q4\" units=\"\" type=\"float\" elements=\"1\"/>\n        <field name=\"Roll\" units=\"degrees\" type=\"float\" elements=\"1\"/>\n        <field name=\"Pitch\" units=\"degrees\" type=\"float\" elements=\"1\"/>\n        <field name=\"Yaw\" units=\"degrees\" type=\"float\" elements=\"1\"/>\n        <access gcs=\"readonly\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"false\" updatemode=\"manual\" period=\"0\"/>\n        <telemetryflight acked=\"false\" updatemode=\"periodic\" period=\"200\"/>\n        <logging updatemode=\"periodic\" period=\"1000\"/>\n    </object>\n</xml>\n"),
+		"firmwareiapobj.xml":       []byte("<xml>\n    <object name=\"FirmwareIAPObj\" singleinstance=\"true\" settings=\"false\">\n        <description>Queries board for SN, model, revision, and sends reset command</description>\n        <field name=\"Command\" units=\"\" type=\"uint16\" elements=\"1\"/>\n        <field name=\"Description\" units=\"\" type=\"uint8\" elements=\"100\"/>\n        <field name=\"CPUSerial\" units=\"\" type=\"uint8\" elements=\"12\"/>\n        <field name=\"BoardRevision\" units=\"\" type=\"uint16\" elements=\"1\"/>\n        <field name=\"BoardType\" units=\"\" type=\"uint8\" elements=\"1\"/>\n        <field name=\"ArmReset\" units=\"\" type=\"uint8\" elements=\"1\"/>\n        <field name=\"crc\" units=\"\" type=\"uint32\" elements=\"1\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"true\" updatemode=\"manual\" period=\"0\"/>\n        <telemetryflight acked=\"true\" updatemode=\"manual\" period=\"0\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+		"flighttelemetrystats.xml": []byte("<xml>\n    <object name=\"FlightTelemetryStats\" singleinstance=\"true\" settings=\"false\" category=\"System\">\n        <description>Maintains the telemetry statistics from the OpenPilot flight computer.</description>\n        <field name=\"TxDataRate\" units=\"bytes/sec\" type=\"float\" elements=\"1\"/>\n        <field name=\"RxDataRate\" units=\"bytes/sec\" type=\"float\" elements=\"1\"/>\n        <field name=\"TxFailures\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"RxFailures\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"TxRetries\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"Status\" units=\"\" type=\"enum\" elements=\"1\" options=\"Disconnected,HandshakeReq,HandshakeAck,Connected\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"false\" updatemode=\"manual\" period=\"0\"/>\n        <telemetryflight acked=\"false\" updatemode=\"periodic\" period=\"5000\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+		"gcstelemetrystats.xml":    []byte("<xml>\n    <object name=\"GCSTelemetryStats\" singleinstance=\"true\" settings=\"false\" category=\"System\">\n        <description>The telemetry statistics from the ground computer</description>\n        <field name=\"TxDataRate\" units=\"bytes/sec\" type=\"float\" elements=\"1\"/>\n        <field name=\"RxDataRate\" units=\"bytes/sec\" type=\"float\" elements=\"1\"/>\n        <field name=\"TxFailures\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"RxFailures\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"TxRetries\" units=\"count\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"Status\" units=\"\" type=\"enum\" elements=\"1\" options=\"Disconnected,HandshakeReq,HandshakeAck,Connected\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"false\" updatemode=\"manual\" period=\"0\"/>\n        <telemetryflight acked=\"false\" updatemode=\"onchange\" period=\"0\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+		"objectpersistence.xml":    []byte("<xml>\n    <object name=\"ObjectPersistence\" singleinstance=\"true\" settings=\"false\" category=\"System\">\n        <description>Someone who knows please enter this</description>\n        <field name=\"ObjectID\" units=\"\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"InstanceID\" units=\"\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"Operation\" units=\"\" type=\"enum\" elements=\"1\" options=\"NOP,Load,Save,Delete,FullErase,Completed,Error\"/>\n        <field name=\"Selection\" units=\"\" type=\"enum\" elements=\"1\" options=\"SingleObject,AllSettings,AllMetaObjects,AllObjects\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"true\" updatemode=\"onchange\" period=\"0\"/>\n        <telemetryflight acked=\"true\" updatemode=\"onchange\" period=\"0\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+		"sessionmanaging.xml":      []byte("<xml>\n    <object name=\"SessionManaging\" singleinstance=\"true\" settings=\"false\" category=\"System\">\n        <description>Provides session managing to uavtalk</description>\n        <field name=\"SessionID\" units=\"\" type=\"uint16\" elements=\"1\"/>\n        <field name=\"ObjectID\" units=\"\" type=\"uint32\" elements=\"1\"/>\n        <field name=\"ObjectInstances\" units=\"\" type=\"uint8\" elements=\"1\"/>\n        <field name=\"NumberOfObjects\" units=\"\" type=\"uint8\" elements=\"1\"/>\n        <field name=\"ObjectOfInterestIndex\" units=\"\" type=\"uint8\" elements=\"1\"/>\n        <access gcs=\"readwrite\" flight=\"readwrite\"/>\n        <telemetrygcs acked=\"true\" updatemode=\"manual\" period=\"0\"/>\n        <telemetryflight acked=\"true\" updatemode=\"manual\" period=\"0\"/>\n        <logging updatemode=\"manual\" period=\"0\"/>\n    </object>\n</xml>\n"),
+	})
+}
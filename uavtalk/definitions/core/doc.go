@@ -0,0 +1,14 @@
+// Package core bundles the UAVObject definitions the bridge needs to talk to a Tau Labs flight controller:
+// the telemetry, session and persistence objects, and the firmware identification. It registers them
+// as the "core" definition set as a side effect of its import, and holds their Go types generated by uavobjgen.
+// To use:
+//
+//	import _ "github.com/HackerLoop/rotonde-uavtalk/uavtalk/definitions/core"
+//
+// The set is not a firmware's complete set, so its UAVO hash matches no firmware: a bridge using it
+// is read-only, and the objects it does not define are not forwarded. It serves the simulator and tests,
+// and is picked with -definitions core, the definitions of a firmware are read from a directory.
+package core
+
+//go:generate go run ../../../cmd/uavobjbundle -name core -package core -o bundle.go xml
+//go:generate go run ../../../cmd/uavobjgen -package core -o uavobjects.go xml
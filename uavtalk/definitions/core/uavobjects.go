@@ -0,0 +1,645 @@
+// Code generated by uavobjgen from xml; DO NOT EDIT.
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// AccessoryDesiredObjectID is the UAVTalk object ID of AccessoryDesired
+const AccessoryDesiredObjectID = 0xC409985A
+
+// AccessoryDesiredLength is the length of the AccessoryDesired data
+const AccessoryDesiredLength = 4
+
+// AccessoryDesired Desired Auxillary actuator settings.
+type AccessoryDesired struct {
+	AccessoryVal float32 // %
+}
+
+// UAVObjectID returns AccessoryDesiredObjectID
+func (o *AccessoryDesired) UAVObjectID() uint32 {
+	return AccessoryDesiredObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *AccessoryDesired) MarshalBinary() ([]byte, error) {
+	data := make([]byte, AccessoryDesiredLength)
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(o.AccessoryVal))
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *AccessoryDesired) UnmarshalBinary(data []byte) error {
+	if len(data) != AccessoryDesiredLength {
+		return fmt.Errorf("AccessoryDesired: %d bytes, expected %d", len(data), AccessoryDesiredLength)
+	}
+	o.AccessoryVal = math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))
+	return nil
+}
+
+// AttitudeActualObjectID is the UAVTalk object ID of AttitudeActual
+const AttitudeActualObjectID = 0x33DAD5E6
+
+// AttitudeActualLength is the length of the AttitudeActual data
+const AttitudeActualLength = 28
+
+// AttitudeActual The updated Attitude estimation from @ref AHRSCommsModule.
+type AttitudeActual struct {
+	Q1    float32
+	Q2    float32
+	Q3    float32
+	Q4    float32
+	Roll  float32 // degrees
+	Pitch float32 // degrees
+	Yaw   float32 // degrees
+}
+
+// UAVObjectID returns AttitudeActualObjectID
+func (o *AttitudeActual) UAVObjectID() uint32 {
+	return AttitudeActualObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *AttitudeActual) MarshalBinary() ([]byte, error) {
+	data := make([]byte, AttitudeActualLength)
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(o.Q1))
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(o.Q2))
+	binary.LittleEndian.PutUint32(data[8:], math.Float32bits(o.Q3))
+	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(o.Q4))
+	binary.LittleEndian.PutUint32(data[16:], math.Float32bits(o.Roll))
+	binary.LittleEndian.PutUint32(data[20:], math.Float32bits(o.Pitch))
+	binary.LittleEndian.PutUint32(data[24:], math.Float32bits(o.Yaw))
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *AttitudeActual) UnmarshalBinary(data []byte) error {
+	if len(data) != AttitudeActualLength {
+		return fmt.Errorf("AttitudeActual: %d bytes, expected %d", len(data), AttitudeActualLength)
+	}
+	o.Q1 = math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))
+	o.Q2 = math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))
+	o.Q3 = math.Float32frombits(binary.LittleEndian.Uint32(data[8:]))
+	o.Q4 = math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))
+	o.Roll = math.Float32frombits(binary.LittleEndian.Uint32(data[16:]))
+	o.Pitch = math.Float32frombits(binary.LittleEndian.Uint32(data[20:]))
+	o.Yaw = math.Float32frombits(binary.LittleEndian.Uint32(data[24:]))
+	return nil
+}
+
+// FirmwareIAPObjObjectID is the UAVTalk object ID of FirmwareIAPObj
+const FirmwareIAPObjObjectID = 0x5E6E8FDC
+
+// FirmwareIAPObjLength is the length of the FirmwareIAPObj data
+const FirmwareIAPObjLength = 122
+
+// FirmwareIAPObj Queries board for SN, model, revision, and sends reset command
+type FirmwareIAPObj struct {
+	Crc           uint32
+	Command       uint16
+	BoardRevision uint16
+	Description   [100]uint8
+	CPUSerial     [12]uint8
+	BoardType     uint8
+	ArmReset      uint8
+}
+
+// UAVObjectID returns FirmwareIAPObjObjectID
+func (o *FirmwareIAPObj) UAVObjectID() uint32 {
+	return FirmwareIAPObjObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *FirmwareIAPObj) MarshalBinary() ([]byte, error) {
+	data := make([]byte, FirmwareIAPObjLength)
+	binary.LittleEndian.PutUint32(data[0:], uint32(o.Crc))
+	binary.LittleEndian.PutUint16(data[4:], uint16(o.Command))
+	binary.LittleEndian.PutUint16(data[6:], uint16(o.BoardRevision))
+	data[8] = byte(o.Description[0])
+	data[9] = byte(o.Description[1])
+	data[10] = byte(o.Description[2])
+	data[11] = byte(o.Description[3])
+	data[12] = byte(o.Description[4])
+	data[13] = byte(o.Description[5])
+	data[14] = byte(o.Description[6])
+	data[15] = byte(o.Description[7])
+	data[16] = byte(o.Description[8])
+	data[17] = byte(o.Description[9])
+	data[18] = byte(o.Description[10])
+	data[19] = byte(o.Description[11])
+	data[20] = byte(o.Description[12])
+	data[21] = byte(o.Description[13])
+	data[22] = byte(o.Description[14])
+	data[23] = byte(o.Description[15])
+	data[24] = byte(o.Description[16])
+	data[25] = byte(o.Description[17])
+	data[26] = byte(o.Description[18])
+	data[27] = byte(o.Description[19])
+	data[28] = byte(o.Description[20])
+	data[29] = byte(o.Description[21])
+	data[30] = byte(o.Description[22])
+	data[31] = byte(o.Description[23])
+	data[32] = byte(o.Description[24])
+	data[33] = byte(o.Description[25])
+	data[34] = byte(o.Description[26])
+	data[35] = byte(o.Description[27])
+	data[36] = byte(o.Description[28])
+	data[37] = byte(o.Description[29])
+	data[38] = byte(o.Description[30])
+	data[39] = byte(o.Description[31])
+	data[40] = byte(o.Description[32])
+	data[41] = byte(o.Description[33])
+	data[42] = byte(o.Description[34])
+	data[43] = byte(o.Description[35])
+	data[44] = byte(o.Description[36])
+	data[45] = byte(o.Description[37])
+	data[46] = byte(o.Description[38])
+	data[47] = byte(o.Description[39])
+	data[48] = byte(o.Description[40])
+	data[49] = byte(o.Description[41])
+	data[50] = byte(o.Description[42])
+	data[51] = byte(o.Description[43])
+	data[52] = byte(o.Description[44])
+	data[53] = byte(o.Description[45])
+	data[54] = byte(o.Description[46])
+	data[55] = byte(o.Description[47])
+	data[56] = byte(o.Description[48])
+	data[57] = byte(o.Description[49])
+	data[58] = byte(o.Description[50])
+	data[59] = byte(o.Description[51])
+	data[60] = byte(o.Description[52])
+	data[61] = byte(o.Description[53])
+	data[62] = byte(o.Description[54])
+	data[63] = byte(o.Description[55])
+	data[64] = byte(o.Description[56])
+	data[65] = byte(o.Description[57])
+	data[66] = byte(o.Description[58])
+	data[67] = byte(o.Description[59])
+	data[68] = byte(o.Description[60])
+	data[69] = byte(o.Description[61])
+	data[70] = byte(o.Description[62])
+	data[71] = byte(o.Description[63])
+	data[72] = byte(o.Description[64])
+	data[73] = byte(o.Description[65])
+	data[74] = byte(o.Description[66])
+	data[75] = byte(o.Description[67])
+	data[76] = byte(o.Description[68])
+	data[77] = byte(o.Description[69])
+	data[78] = byte(o.Description[70])
+	data[79] = byte(o.Description[71])
+	data[80] = byte(o.Description[72])
+	data[81] = byte(o.Description[73])
+	data[82] = byte(o.Description[74])
+	data[83] = byte(o.Description[75])
+	data[84] = byte(o.Description[76])
+	data[85] = byte(o.Description[77])
+	data[86] = byte(o.Description[78])
+	data[87] = byte(o.Description[79])
+	data[88] = byte(o.Description[80])
+	data[89] = byte(o.Description[81])
+	data[90] = byte(o.Description[82])
+	data[91] = byte(o.Description[83])
+	data[92] = byte(o.Description[84])
+	data[93] = byte(o.Description[85])
+	data[94] = byte(o.Description[86])
+	data[95] = byte(o.Description[87])
+	data[96] = byte(o.Description[88])
+	data[97] = byte(o.Description[89])
+	data[98] = byte(o.Description[90])
+	data[99] = byte(o.Description[91])
+	data[100] = byte(o.Description[92])
+	data[101] = byte(o.Description[93])
+	data[102] = byte(o.Description[94])
+	data[103] = byte(o.Description[95])
+	data[104] = byte(o.Description[96])
+	data[105] = byte(o.Description[97])
+	data[106] = byte(o.Description[98])
+	data[107] = byte(o.Description[99])
+	data[108] = byte(o.CPUSerial[0])
+	data[109] = byte(o.CPUSerial[1])
+	data[110] = byte(o.CPUSerial[2])
+	data[111] = byte(o.CPUSerial[3])
+	data[112] = byte(o.CPUSerial[4])
+	data[113] = byte(o.CPUSerial[5])
+	data[114] = byte(o.CPUSerial[6])
+	data[115] = byte(o.CPUSerial[7])
+	data[116] = byte(o.CPUSerial[8])
+	data[117] = byte(o.CPUSerial[9])
+	data[118] = byte(o.CPUSerial[10])
+	data[119] = byte(o.CPUSerial[11])
+	data[120] = byte(o.BoardType)
+	data[121] = byte(o.ArmReset)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *FirmwareIAPObj) UnmarshalBinary(data []byte) error {
+	if len(data) != FirmwareIAPObjLength {
+		return fmt.Errorf("FirmwareIAPObj: %d bytes, expected %d", len(data), FirmwareIAPObjLength)
+	}
+	o.Crc = uint32(binary.LittleEndian.Uint32(data[0:]))
+	o.Command = uint16(binary.LittleEndian.Uint16(data[4:]))
+	o.BoardRevision = uint16(binary.LittleEndian.Uint16(data[6:]))
+	o.Description[0] = uint8(data[8])
+	o.Description[1] = uint8(data[9])
+	o.Description[2] = uint8(data[10])
+	o.Description[3] = uint8(data[11])
+	o.Description[4] = uint8(data[12])
+	o.Description[5] = uint8(data[13])
+	o.Description[6] = uint8(data[14])
+	o.Description[7] = uint8(data[15])
+	o.Description[8] = uint8(data[16])
+	o.Description[9] = uint8(data[17])
+	o.Description[10] = uint8(data[18])
+	o.Description[11] = uint8(data[19])
+	o.Description[12] = uint8(data[20])
+	o.Description[13] = uint8(data[21])
+	o.Description[14] = uint8(data[22])
+	o.Description[15] = uint8(data[23])
+	o.Description[16] = uint8(data[24])
+	o.Description[17] = uint8(data[25])
+	o.Description[18] = uint8(data[26])
+	o.Description[19] = uint8(data[27])
+	o.Description[20] = uint8(data[28])
+	o.Description[21] = uint8(data[29])
+	o.Description[22] = uint8(data[30])
+	o.Description[23] = uint8(data[31])
+	o.Description[24] = uint8(data[32])
+	o.Description[25] = uint8(data[33])
+	o.Description[26] = uint8(data[34])
+	o.Description[27] = uint8(data[35])
+	o.Description[28] = uint8(data[36])
+	o.Description[29] = uint8(data[37])
+	o.Description[30] = uint8(data[38])
+	o.Description[31] = uint8(data[39])
+	o.Description[32] = uint8(data[40])
+	o.Description[33] = uint8(data[41])
+	o.Description[34] = uint8(data[42])
+	o.Description[35] = uint8(data[43])
+	o.Description[36] = uint8(data[44])
+	o.Description[37] = uint8(data[45])
+	o.Description[38] = uint8(data[46])
+	o.Description[39] = uint8(data[47])
+	o.Description[40] = uint8(data[48])
+	o.Description[41] = uint8(data[49])
+	o.Description[42] = uint8(data[50])
+	o.Description[43] = uint8(data[51])
+	o.Description[44] = uint8(data[52])
+	o.Description[45] = uint8(data[53])
+	o.Description[46] = uint8(data[54])
+	o.Description[47] = uint8(data[55])
+	o.Description[48] = uint8(data[56])
+	o.Description[49] = uint8(data[57])
+	o.Description[50] = uint8(data[58])
+	o.Description[51] = uint8(data[59])
+	o.Description[52] = uint8(data[60])
+	o.Description[53] = uint8(data[61])
+	o.Description[54] = uint8(data[62])
+	o.Description[55] = uint8(data[63])
+	o.Description[56] = uint8(data[64])
+	o.Description[57] = uint8(data[65])
+	o.Description[58] = uint8(data[66])
+	o.Description[59] = uint8(data[67])
+	o.Description[60] = uint8(data[68])
+	o.Description[61] = uint8(data[69])
+	o.Description[62] = uint8(data[70])
+	o.Description[63] = uint8(data[71])
+	o.Description[64] = uint8(data[72])
+	o.Description[65] = uint8(data[73])
+	o.Description[66] = uint8(data[74])
+	o.Description[67] = uint8(data[75])
+	o.Description[68] = uint8(data[76])
+	o.Description[69] = uint8(data[77])
+	o.Description[70] = uint8(data[78])
+	o.Description[71] = uint8(data[79])
+	o.Description[72] = uint8(data[80])
+	o.Description[73] = uint8(data[81])
+	o.Description[74] = uint8(data[82])
+	o.Description[75] = uint8(data[83])
+	o.Description[76] = uint8(data[84])
+	o.Description[77] = uint8(data[85])
+	o.Description[78] = uint8(data[86])
+	o.Description[79] = uint8(data[87])
+	o.Description[80] = uint8(data[88])
+	o.Description[81] = uint8(data[89])
+	o.Description[82] = uint8(data[90])
+	o.Description[83] = uint8(data[91])
+	o.Description[84] = uint8(data[92])
+	o.Description[85] = uint8(data[93])
+	o.Description[86] = uint8(data[94])
+	o.Description[87] = uint8(data[95])
+	o.Description[88] = uint8(data[96])
+	o.Description[89] = uint8(data[97])
+	o.Description[90] = uint8(data[98])
+	o.Description[91] = uint8(data[99])
+	o.Description[92] = uint8(data[100])
+	o.Description[93] = uint8(data[101])
+	o.Description[94] = uint8(data[102])
+	o.Description[95] = uint8(data[103])
+	o.Description[96] = uint8(data[104])
+	o.Description[97] = uint8(data[105])
+	o.Description[98] = uint8(data[106])
+	o.Description[99] = uint8(data[107])
+	o.CPUSerial[0] = uint8(data[108])
+	o.CPUSerial[1] = uint8(data[109])
+	o.CPUSerial[2] = uint8(data[110])
+	o.CPUSerial[3] = uint8(data[111])
+	o.CPUSerial[4] = uint8(data[112])
+	o.CPUSerial[5] = uint8(data[113])
+	o.CPUSerial[6] = uint8(data[114])
+	o.CPUSerial[7] = uint8(data[115])
+	o.CPUSerial[8] = uint8(data[116])
+	o.CPUSerial[9] = uint8(data[117])
+	o.CPUSerial[10] = uint8(data[118])
+	o.CPUSerial[11] = uint8(data[119])
+	o.BoardType = uint8(data[120])
+	o.ArmReset = uint8(data[121])
+	return nil
+}
+
+// FlightTelemetryStatsStatusOption are the options of FlightTelemetryStats.Status
+type FlightTelemetryStatsStatusOption uint8
+
+const (
+	FlightTelemetryStatsStatusDisconnected FlightTelemetryStatsStatusOption = 0
+	FlightTelemetryStatsStatusHandshakeReq FlightTelemetryStatsStatusOption = 1
+	FlightTelemetryStatsStatusHandshakeAck FlightTelemetryStatsStatusOption = 2
+	FlightTelemetryStatsStatusConnected    FlightTelemetryStatsStatusOption = 3
+)
+
+func (v FlightTelemetryStatsStatusOption) String() string {
+	switch v {
+	case 0:
+		return "Disconnected"
+	case 1:
+		return "HandshakeReq"
+	case 2:
+		return "HandshakeAck"
+	case 3:
+		return "Connected"
+	}
+	return fmt.Sprintf("FlightTelemetryStatsStatusOption(%d)", uint8(v))
+}
+
+// FlightTelemetryStatsObjectID is the UAVTalk object ID of FlightTelemetryStats
+const FlightTelemetryStatsObjectID = 0x2F7E2902
+
+// FlightTelemetryStatsLength is the length of the FlightTelemetryStats data
+const FlightTelemetryStatsLength = 21
+
+// FlightTelemetryStats Maintains the telemetry statistics from the OpenPilot flight computer.
+type FlightTelemetryStats struct {
+	TxDataRate float32 // bytes/sec
+	RxDataRate float32 // bytes/sec
+	TxFailures uint32  // count
+	RxFailures uint32  // count
+	TxRetries  uint32  // count
+	Status     FlightTelemetryStatsStatusOption
+}
+
+// UAVObjectID returns FlightTelemetryStatsObjectID
+func (o *FlightTelemetryStats) UAVObjectID() uint32 {
+	return FlightTelemetryStatsObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *FlightTelemetryStats) MarshalBinary() ([]byte, error) {
+	data := make([]byte, FlightTelemetryStatsLength)
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(o.TxDataRate))
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(o.RxDataRate))
+	binary.LittleEndian.PutUint32(data[8:], uint32(o.TxFailures))
+	binary.LittleEndian.PutUint32(data[12:], uint32(o.RxFailures))
+	binary.LittleEndian.PutUint32(data[16:], uint32(o.TxRetries))
+	data[20] = byte(o.Status)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *FlightTelemetryStats) UnmarshalBinary(data []byte) error {
+	if len(data) != FlightTelemetryStatsLength {
+		return fmt.Errorf("FlightTelemetryStats: %d bytes, expected %d", len(data), FlightTelemetryStatsLength)
+	}
+	o.TxDataRate = math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))
+	o.RxDataRate = math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))
+	o.TxFailures = uint32(binary.LittleEndian.Uint32(data[8:]))
+	o.RxFailures = uint32(binary.LittleEndian.Uint32(data[12:]))
+	o.TxRetries = uint32(binary.LittleEndian.Uint32(data[16:]))
+	o.Status = FlightTelemetryStatsStatusOption(data[20])
+	return nil
+}
+
+// GCSTelemetryStatsStatusOption are the options of GCSTelemetryStats.Status
+type GCSTelemetryStatsStatusOption uint8
+
+const (
+	GCSTelemetryStatsStatusDisconnected GCSTelemetryStatsStatusOption = 0
+	GCSTelemetryStatsStatusHandshakeReq GCSTelemetryStatsStatusOption = 1
+	GCSTelemetryStatsStatusHandshakeAck GCSTelemetryStatsStatusOption = 2
+	GCSTelemetryStatsStatusConnected    GCSTelemetryStatsStatusOption = 3
+)
+
+func (v GCSTelemetryStatsStatusOption) String() string {
+	switch v {
+	case 0:
+		return "Disconnected"
+	case 1:
+		return "HandshakeReq"
+	case 2:
+		return "HandshakeAck"
+	case 3:
+		return "Connected"
+	}
+	return fmt.Sprintf("GCSTelemetryStatsStatusOption(%d)", uint8(v))
+}
+
+// GCSTelemetryStatsObjectID is the UAVTalk object ID of GCSTelemetryStats
+const GCSTelemetryStatsObjectID = 0xABC72744
+
+// GCSTelemetryStatsLength is the length of the GCSTelemetryStats data
+const GCSTelemetryStatsLength = 21
+
+// GCSTelemetryStats The telemetry statistics from the ground computer
+type GCSTelemetryStats struct {
+	TxDataRate float32 // bytes/sec
+	RxDataRate float32 // bytes/sec
+	TxFailures uint32  // count
+	RxFailures uint32  // count
+	TxRetries  uint32  // count
+	Status     GCSTelemetryStatsStatusOption
+}
+
+// UAVObjectID returns GCSTelemetryStatsObjectID
+func (o *GCSTelemetryStats) UAVObjectID() uint32 {
+	return GCSTelemetryStatsObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *GCSTelemetryStats) MarshalBinary() ([]byte, error) {
+	data := make([]byte, GCSTelemetryStatsLength)
+	binary.LittleEndian.PutUint32(data[0:], math.Float32bits(o.TxDataRate))
+	binary.LittleEndian.PutUint32(data[4:], math.Float32bits(o.RxDataRate))
+	binary.LittleEndian.PutUint32(data[8:], uint32(o.TxFailures))
+	binary.LittleEndian.PutUint32(data[12:], uint32(o.RxFailures))
+	binary.LittleEndian.PutUint32(data[16:], uint32(o.TxRetries))
+	data[20] = byte(o.Status)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *GCSTelemetryStats) UnmarshalBinary(data []byte) error {
+	if len(data) != GCSTelemetryStatsLength {
+		return fmt.Errorf("GCSTelemetryStats: %d bytes, expected %d", len(data), GCSTelemetryStatsLength)
+	}
+	o.TxDataRate = math.Float32frombits(binary.LittleEndian.Uint32(data[0:]))
+	o.RxDataRate = math.Float32frombits(binary.LittleEndian.Uint32(data[4:]))
+	o.TxFailures = uint32(binary.LittleEndian.Uint32(data[8:]))
+	o.RxFailures = uint32(binary.LittleEndian.Uint32(data[12:]))
+	o.TxRetries = uint32(binary.LittleEndian.Uint32(data[16:]))
+	o.Status = GCSTelemetryStatsStatusOption(data[20])
+	return nil
+}
+
+// ObjectPersistenceOperationOption are the options of ObjectPersistence.Operation
+type ObjectPersistenceOperationOption uint8
+
+const (
+	ObjectPersistenceOperationNOP       ObjectPersistenceOperationOption = 0
+	ObjectPersistenceOperationLoad      ObjectPersistenceOperationOption = 1
+	ObjectPersistenceOperationSave      ObjectPersistenceOperationOption = 2
+	ObjectPersistenceOperationDelete    ObjectPersistenceOperationOption = 3
+	ObjectPersistenceOperationFullErase ObjectPersistenceOperationOption = 4
+	ObjectPersistenceOperationCompleted ObjectPersistenceOperationOption = 5
+	ObjectPersistenceOperationError     ObjectPersistenceOperationOption = 6
+)
+
+func (v ObjectPersistenceOperationOption) String() string {
+	switch v {
+	case 0:
+		return "NOP"
+	case 1:
+		return "Load"
+	case 2:
+		return "Save"
+	case 3:
+		return "Delete"
+	case 4:
+		return "FullErase"
+	case 5:
+		return "Completed"
+	case 6:
+		return "Error"
+	}
+	return fmt.Sprintf("ObjectPersistenceOperationOption(%d)", uint8(v))
+}
+
+// ObjectPersistenceSelectionOption are the options of ObjectPersistence.Selection
+type ObjectPersistenceSelectionOption uint8
+
+const (
+	ObjectPersistenceSelectionSingleObject   ObjectPersistenceSelectionOption = 0
+	ObjectPersistenceSelectionAllSettings    ObjectPersistenceSelectionOption = 1
+	ObjectPersistenceSelectionAllMetaObjects ObjectPersistenceSelectionOption = 2
+	ObjectPersistenceSelectionAllObjects     ObjectPersistenceSelectionOption = 3
+)
+
+func (v ObjectPersistenceSelectionOption) String() string {
+	switch v {
+	case 0:
+		return "SingleObject"
+	case 1:
+		return "AllSettings"
+	case 2:
+		return "AllMetaObjects"
+	case 3:
+		return "AllObjects"
+	}
+	return fmt.Sprintf("ObjectPersistenceSelectionOption(%d)", uint8(v))
+}
+
+// ObjectPersistenceObjectID is the UAVTalk object ID of ObjectPersistence
+const ObjectPersistenceObjectID = 0x99C63292
+
+// ObjectPersistenceLength is the length of the ObjectPersistence data
+const ObjectPersistenceLength = 10
+
+// ObjectPersistence Someone who knows please enter this
+type ObjectPersistence struct {
+	ObjectID   uint32
+	InstanceID uint32
+	Operation  ObjectPersistenceOperationOption
+	Selection  ObjectPersistenceSelectionOption
+}
+
+// UAVObjectID returns ObjectPersistenceObjectID
+func (o *ObjectPersistence) UAVObjectID() uint32 {
+	return ObjectPersistenceObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *ObjectPersistence) MarshalBinary() ([]byte, error) {
+	data := make([]byte, ObjectPersistenceLength)
+	binary.LittleEndian.PutUint32(data[0:], uint32(o.ObjectID))
+	binary.LittleEndian.PutUint32(data[4:], uint32(o.InstanceID))
+	data[8] = byte(o.Operation)
+	data[9] = byte(o.Selection)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *ObjectPersistence) UnmarshalBinary(data []byte) error {
+	if len(data) != ObjectPersistenceLength {
+		return fmt.Errorf("ObjectPersistence: %d bytes, expected %d", len(data), ObjectPersistenceLength)
+	}
+	o.ObjectID = uint32(binary.LittleEndian.Uint32(data[0:]))
+	o.InstanceID = uint32(binary.LittleEndian.Uint32(data[4:]))
+	o.Operation = ObjectPersistenceOperationOption(data[8])
+	o.Selection = ObjectPersistenceSelectionOption(data[9])
+	return nil
+}
+
+// SessionManagingObjectID is the UAVTalk object ID of SessionManaging
+const SessionManagingObjectID = 0x89034E4A
+
+// SessionManagingLength is the length of the SessionManaging data
+const SessionManagingLength = 9
+
+// SessionManaging Provides session managing to uavtalk
+type SessionManaging struct {
+	ObjectID              uint32
+	SessionID             uint16
+	ObjectInstances       uint8
+	NumberOfObjects       uint8
+	ObjectOfInterestIndex uint8
+}
+
+// UAVObjectID returns SessionManagingObjectID
+func (o *SessionManaging) UAVObjectID() uint32 {
+	return SessionManagingObjectID
+}
+
+// MarshalBinary encodes the object as in UAVTalk packets
+func (o *SessionManaging) MarshalBinary() ([]byte, error) {
+	data := make([]byte, SessionManagingLength)
+	binary.LittleEndian.PutUint32(data[0:], uint32(o.ObjectID))
+	binary.LittleEndian.PutUint16(data[4:], uint16(o.SessionID))
+	data[6] = byte(o.ObjectInstances)
+	data[7] = byte(o.NumberOfObjects)
+	data[8] = byte(o.ObjectOfInterestIndex)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the object from the data of a UAVTalk packet
+func (o *SessionManaging) UnmarshalBinary(data []byte) error {
+	if len(data) != SessionManagingLength {
+		return fmt.Errorf("SessionManaging: %d bytes, expected %d", len(data), SessionManagingLength)
+	}
+	o.ObjectID = uint32(binary.LittleEndian.Uint32(data[0:]))
+	o.SessionID = uint16(binary.LittleEndian.Uint16(data[4:]))
+	o.ObjectInstances = uint8(data[6])
+	o.NumberOfObjects = uint8(data[7])
+	o.ObjectOfInterestIndex = uint8(data[8])
+	return nil
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+)
+
+// the generated types encode as the uavtalk package does
+func TestGeneratedMatchesPackets(t *testing.T) {
+	registry, err := uavtalk.LoadDefinitionSet("core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition, err := registry.GetDefinitionForName("ObjectPersistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if definition.ObjectID != ObjectPersistenceObjectID {
+		t.Fatalf("ObjectID %08x, generated %08x", definition.ObjectID, ObjectPersistenceObjectID)
+	}
+
+	object := ObjectPersistence{
+		ObjectID:   0xdeadbeef,
+		InstanceID: 3,
+		Operation:  ObjectPersistenceOperationSave,
+		Selection:  ObjectPersistenceSelectionAllSettings,
+	}
+	data, err := object.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := uavtalk.NewPacket(definition, uavtalk.ObjectCmd, 0, map[string]interface{}{
+		"ObjectID": float64(0xdeadbeef), "InstanceID": float64(3), "Operation": "Save", "Selection": "AllSettings",
+	})
+	frame, err := packet.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header: sync, type, length, object ID, then the data and the crc
+	if packetData := frame[8 : len(frame)-1]; bytes.Equal(data, packetData) == false {
+		t.Fatalf("generated % x, packet % x", data, packetData)
+	}
+
+	var decoded ObjectPersistence
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != object {
+		t.Errorf("decoded %+v, expected %+v", decoded, object)
+	}
+	if decoded.Operation.String() != "Save" {
+		t.Errorf("Operation %s, expected Save", decoded.Operation)
+	}
+	if err := decoded.UnmarshalBinary(data[1:]); err == nil {
+		t.Error("short data decoded")
+	}
+}
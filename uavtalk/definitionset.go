@@ -0,0 +1,92 @@
+package uavtalk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+ * Definition sets are the UAVObject XML files of a firmware, read from a directory,
+ * or bundled in the binary: packages generated by cmd/uavobjbundle register their files with RegisterDefinitionSet
+ * as a side effect of their import, eg.
+ *	import _ "github.com/HackerLoop/rotonde-uavtalk/uavtalk/definitions/core"
+ */
+
+// DefinitionFiles holds the content of XML definition files, by file name
+type DefinitionFiles map[string][]byte
+
+// Names returns the file names, sorted
+func (files DefinitionFiles) Names() []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadDefinitionFiles reads the xml files of a directory, other files and sub directories are skipped
+func ReadDefinitionFiles(dir string) (DefinitionFiles, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := DefinitionFiles{}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || strings.ToLower(filepath.Ext(fileInfo.Name())) != ".xml" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, fileInfo.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[fileInfo.Name()] = data
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No xml definition files in %s", dir)
+	}
+	return files, nil
+}
+
+var definitionSets = map[string]DefinitionFiles{}
+var definitionSetsMutex sync.RWMutex
+
+// RegisterDefinitionSet makes a bundled definition set available by name, registering the same name twice panics
+func RegisterDefinitionSet(name string, files DefinitionFiles) {
+	definitionSetsMutex.Lock()
+	defer definitionSetsMutex.Unlock()
+
+	if _, exists := definitionSets[name]; exists {
+		panic(fmt.Sprintf("uavtalk: RegisterDefinitionSet called twice for %s", name))
+	}
+	definitionSets[name] = files
+}
+
+// DefinitionSets returns the names of the bundled definition sets
+func DefinitionSets() []string {
+	definitionSetsMutex.RLock()
+	defer definitionSetsMutex.RUnlock()
+
+	names := make([]string, 0, len(definitionSets))
+	for name := range definitionSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDefinitionSet loads a bundled definition set
+func LoadDefinitionSet(name string) (*Registry, error) {
+	definitionSetsMutex.RLock()
+	files, ok := definitionSets[name]
+	definitionSetsMutex.RUnlock()
+	if ok == false {
+		return nil, fmt.Errorf("Definition set %s is not bundled, available: %v", name, DefinitionSets())
+	}
+	return NewRegistryFromFiles(files)
+}
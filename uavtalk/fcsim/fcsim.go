@@ -0,0 +1,349 @@
+package fcsim
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * In-process simulated flight controller, for tests and demos without hardware.
+ * The Simulator is a uavtalk.Linker, what is written to it is handled as if the flight controller received it,
+ * and what it answers can be read from it.
+ *
+ * It supports:
+ *	- the telemetry handshake (GCSTelemetryStats -> FlightTelemetryStats HandshakeAck -> Connected)
+ *	- SessionManaging object enumeration, all the non-meta definitions are reported active, with the number of instances stored
+ *	- storage of received objects, answered back on ObjectRequest
+ *	- FirmwareIAPObj, describing a firmware built with the simulator's definitions (see uavtalk/firmware.go)
+ *	- acks for ObjectCmdWithAck
+ *	- ObjectPersistence operations, reported completed right away
+ *	- periodic telemetry, following each definition's TelemetryFlight settings
+ *
+ * Importing this package registers the sim:// link scheme, using the definitions of the connection.
+ */
+
+const readTimeout = 50 * time.Millisecond
+
+var errClosed = errors.New("Simulator closed")
+
+type objectKey struct {
+	objectID   uint32
+	instanceID uint16
+}
+
+// Simulator is a fake flight controller
+type Simulator struct {
+	definitions simDefinitions
+
+	mutex     sync.Mutex
+	objects   map[objectKey]map[string]interface{}
+	status    string
+	sessionID uint16
+
+	parser  *uavtalk.Parser
+	out     chan []byte
+	pending []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ uavtalk.Linker = (*Simulator)(nil)
+
+// simDefinitions is the uavtalk.Registry, along with the definitions the simulator needs to know
+type simDefinitions struct {
+	*uavtalk.Registry
+
+	sessionManaging      *uavtalk.Definition
+	gcsTelemetryStats    *uavtalk.Definition
+	flightTelemetryStats *uavtalk.Definition
+	firmwareIAPObj       *uavtalk.Definition // nil if not defined
+	objectPersistence    *uavtalk.Definition // nil if not defined
+	active               []*uavtalk.Definition
+}
+
+func newSimDefinitions(registry *uavtalk.Registry) (simDefinitions, error) {
+	result := simDefinitions{Registry: registry}
+
+	var err error
+	if result.sessionManaging, err = registry.GetDefinitionForName("SessionManaging"); err != nil {
+		return result, err
+	}
+	if result.gcsTelemetryStats, err = registry.GetDefinitionForName("GCSTelemetryStats"); err != nil {
+		return result, err
+	}
+	if result.flightTelemetryStats, err = registry.GetDefinitionForName("FlightTelemetryStats"); err != nil {
+		return result, err
+	}
+	result.firmwareIAPObj, _ = registry.GetDefinitionForName("FirmwareIAPObj")
+	result.objectPersistence, _ = registry.GetDefinitionForName("ObjectPersistence")
+
+	for _, definition := range registry.Definitions() {
+		if definition.MetaFor == nil {
+			result.active = append(result.active, definition)
+		}
+	}
+	// NumberOfObjects and ObjectOfInterestIndex are uint8
+	if len(result.active) > 255 {
+		log.Warningf("fcsim: %d objects, only the first 255 will be reported by SessionManaging", len(result.active))
+		result.active = result.active[:255]
+	}
+	return result, nil
+}
+
+// New creates a simulated flight controller, using the definitions of registry, its telemetry starts right away
+func New(registry *uavtalk.Registry) (*Simulator, error) {
+	defs, err := newSimDefinitions(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		definitions: defs,
+		objects:     map[objectKey]map[string]interface{}{},
+		status:      "Disconnected",
+		parser:      uavtalk.NewParser(registry),
+		out:         make(chan []byte, 256),
+		closed:      make(chan struct{}),
+	}
+
+	for _, definition := range defs.active {
+		if definition.TelemetryFlight.UpdateMode != "periodic" {
+			continue
+		}
+		period, err := strconv.Atoi(definition.TelemetryFlight.Period)
+		if err != nil || period <= 0 {
+			continue
+		}
+		go s.periodicTelemetry(definition, time.Duration(period)*time.Millisecond)
+	}
+	return s, nil
+}
+
+func init() {
+	uavtalk.RegisterLink("sim", func(uri *url.URL, registry *uavtalk.Registry) (uavtalk.Linker, error) {
+		return New(registry)
+	})
+}
+
+func (s *Simulator) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		select {
+		case s.pending = <-s.out:
+		case <-s.closed:
+			return 0, errClosed
+		case <-time.After(readTimeout):
+			return 0, nil
+		}
+	}
+
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write handles the packets sent to the flight controller, they can span several writes
+func (s *Simulator) Write(b []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, errClosed
+	default:
+	}
+
+	packets, errs := s.parser.Feed(b)
+	for _, err := range errs {
+		log.Warning("fcsim: ", err)
+	}
+	for _, packet := range packets {
+		s.handle(packet)
+	}
+	return len(b), nil
+}
+
+func (s *Simulator) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+func (s *Simulator) send(packet *uavtalk.Packet) {
+	binaryPacket, err := packet.MarshalBinary()
+	if err != nil {
+		log.Warning("fcsim: ", err)
+		return
+	}
+
+	select {
+	case s.out <- binaryPacket:
+	case <-s.closed:
+	}
+}
+
+func (s *Simulator) periodicTelemetry(definition *uavtalk.Definition, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	cmd := uint8(uavtalk.ObjectCmd)
+	if definition.TelemetryFlight.Acked {
+		cmd = uavtalk.ObjectCmdWithAck
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			s.send(uavtalk.NewPacket(definition, cmd, 0, s.object(definition, 0)))
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// object returns a copy of the stored object, or its default value
+func (s *Simulator) object(definition *uavtalk.Definition, instanceID uint16) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch definition {
+	case s.definitions.flightTelemetryStats:
+		data := definition.DefaultData()
+		data["Status"] = s.status
+		return data
+	case s.definitions.sessionManaging:
+		data := definition.DefaultData()
+		data["SessionID"] = float64(s.sessionID)
+		data["NumberOfObjects"] = float64(len(s.definitions.active))
+		return data
+	case s.definitions.firmwareIAPObj:
+		data := definition.DefaultData()
+		if description, ok := data["Description"].([]interface{}); ok {
+			setUAVOHash(description, s.definitions.UAVOHash())
+		}
+		return data
+	}
+
+	data, ok := s.objects[objectKey{definition.ObjectID, instanceID}]
+	if ok == false {
+		return definition.DefaultData()
+	}
+	return copyData(data)
+}
+
+// instances returns the number of instances of an object, up to the highest instance stored
+func (s *Simulator) instances(definition *uavtalk.Definition) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 1
+	for key := range s.objects {
+		if key.objectID == definition.ObjectID && int(key.instanceID) >= count {
+			count = int(key.instanceID) + 1
+		}
+	}
+	if definition.SingleInstance {
+		return 1
+	}
+	return count
+}
+
+func (s *Simulator) setObject(definition *uavtalk.Definition, instanceID uint16, data map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.objects[objectKey{definition.ObjectID, instanceID}] = normalizeData(data)
+}
+
+func (s *Simulator) handle(packet *uavtalk.Packet) {
+	switch packet.Definition {
+	case s.definitions.gcsTelemetryStats:
+		if packet.Cmd == uavtalk.ObjectCmd || packet.Cmd == uavtalk.ObjectCmdWithAck {
+			s.handleGCSTelemetryStats(packet)
+			return
+		}
+	case s.definitions.sessionManaging:
+		if packet.Cmd == uavtalk.ObjectCmd || packet.Cmd == uavtalk.ObjectCmdWithAck {
+			s.handleSessionManaging(packet)
+			return
+		}
+	}
+
+	switch packet.Cmd {
+	case uavtalk.ObjectCmd:
+		s.setObject(packet.Definition, packet.InstanceID, packet.Data)
+	case uavtalk.ObjectCmdWithAck:
+		s.setObject(packet.Definition, packet.InstanceID, packet.Data)
+		s.send(uavtalk.NewPacket(packet.Definition, uavtalk.ObjectAck, packet.InstanceID, map[string]interface{}{}))
+		if packet.Definition == s.definitions.objectPersistence {
+			s.handleObjectPersistence(packet)
+		}
+	case uavtalk.ObjectRequest:
+		s.send(uavtalk.NewPacket(packet.Definition, uavtalk.ObjectCmd, packet.InstanceID, s.object(packet.Definition, packet.InstanceID)))
+	}
+}
+
+// handleObjectPersistence reports the operation completed, nothing is stored across simulator runs
+func (s *Simulator) handleObjectPersistence(packet *uavtalk.Packet) {
+	switch packet.Data["Operation"] {
+	case "Load", "Save", "Delete", "FullErase":
+	default:
+		return
+	}
+	data := s.object(packet.Definition, packet.InstanceID)
+	data["Operation"] = "Completed"
+	s.setObject(packet.Definition, packet.InstanceID, data)
+	s.send(uavtalk.NewPacket(packet.Definition, uavtalk.ObjectCmd, packet.InstanceID, data))
+}
+
+// handleGCSTelemetryStats answers the telemetry handshake
+func (s *Simulator) handleGCSTelemetryStats(packet *uavtalk.Packet) {
+	if packet.Cmd == uavtalk.ObjectCmdWithAck {
+		s.send(uavtalk.NewPacket(packet.Definition, uavtalk.ObjectAck, 0, map[string]interface{}{}))
+	}
+
+	s.mutex.Lock()
+	switch packet.Data["Status"] {
+	case "HandshakeReq":
+		s.status = "HandshakeAck"
+	case "Connected":
+		if s.status == "HandshakeAck" || s.status == "Connected" {
+			s.status = "Connected"
+		}
+	case "Disconnected":
+		s.status = "Disconnected"
+	}
+	s.mutex.Unlock()
+
+	flightTelemetryStats := s.definitions.flightTelemetryStats
+	s.send(uavtalk.NewPacket(flightTelemetryStats, uavtalk.ObjectCmd, 0, s.object(flightTelemetryStats, 0)))
+}
+
+// handleSessionManaging answers the enumeration of the active objects, one ObjectOfInterestIndex at a time
+func (s *Simulator) handleSessionManaging(packet *uavtalk.Packet) {
+	s.mutex.Lock()
+	if sessionID := uint16(toFloat64(packet.Data["SessionID"])); sessionID != 0 {
+		s.sessionID = sessionID
+	}
+	sessionID := s.sessionID
+	s.mutex.Unlock()
+
+	index := int(toFloat64(packet.Data["ObjectOfInterestIndex"]))
+	reply := map[string]interface{}{
+		"SessionID":             float64(sessionID),
+		"ObjectID":              float64(0),
+		"ObjectInstances":       float64(0),
+		"NumberOfObjects":       float64(len(s.definitions.active)),
+		"ObjectOfInterestIndex": float64(index),
+	}
+	if index < len(s.definitions.active) {
+		definition := s.definitions.active[index]
+		reply["ObjectID"] = float64(definition.ObjectID)
+		reply["ObjectInstances"] = float64(s.instances(definition))
+	}
+	s.send(uavtalk.NewPacket(packet.Definition, uavtalk.ObjectCmdWithAck, 0, reply))
+}
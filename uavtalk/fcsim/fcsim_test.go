@@ -0,0 +1,268 @@
+package fcsim
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+)
+
+// testSettings is a settings object, the bundled definitions have none
+const testSettings = `<xml>
+    <object name="TestSettings" singleinstance="true" settings="true" category="System">
+        <description>Settings written by the tests.</description>
+        <field name="Gain" units="" type="float" elements="1" defaultvalue="1"/>
+        <access gcs="readwrite" flight="readwrite"/>
+        <telemetrygcs acked="true" updatemode="onchange" period="0"/>
+        <telemetryflight acked="true" updatemode="onchange" period="0"/>
+        <logging updatemode="manual" period="0"/>
+    </object>
+</xml>
+`
+
+func testRegistry(t *testing.T) *uavtalk.Registry {
+	files, err := uavtalk.ReadDefinitionFiles("../definitions/core/xml/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["testsettings.xml"] = []byte(testSettings)
+	registry, err := uavtalk.NewRegistryFromFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// bridge is what the rotonde bridge runs for a vehicle, the packets and link states are dispatched as its handlers do
+type bridge struct {
+	connection   *uavtalk.Connection
+	telemetry    *uavtalk.Telemetry
+	session      *uavtalk.Session
+	transactions *uavtalk.Transactions
+	statuses     chan uavtalk.TelemetryStatus
+	sessions     chan []uavtalk.ActiveObject
+}
+
+func startBridge(linkURI string, registry *uavtalk.Registry) *bridge {
+	connection := uavtalk.NewConnection(linkURI, registry)
+	connection.Library = uavtalk.NewLibrary()
+	connection.Library.Add("test", registry)
+
+	b := &bridge{
+		connection:   connection,
+		telemetry:    uavtalk.NewTelemetry(connection),
+		session:      uavtalk.NewSession(connection),
+		transactions: uavtalk.NewTransactions(connection),
+		statuses:     make(chan uavtalk.TelemetryStatus, 10),
+		sessions:     make(chan []uavtalk.ActiveObject, 10),
+	}
+	b.telemetry.OnStatusChange(func(status uavtalk.TelemetryStatus) {
+		if status == uavtalk.TelemetryConnected {
+			b.session.Begin()
+		}
+		b.statuses <- status
+	})
+	b.session.OnComplete(func(sessionID uint16, objects []uavtalk.ActiveObject) {
+		b.sessions <- objects
+	})
+
+	go connection.Start()
+	go b.telemetry.Start()
+	go b.session.Start()
+	go func() {
+		for {
+			select {
+			case packet := <-connection.OutChan:
+				b.telemetry.HandlePacket(packet)
+				b.session.HandlePacket(packet)
+				b.transactions.HandlePacket(packet)
+			case state := <-connection.StateChan:
+				b.telemetry.HandleLinkState(state)
+				b.session.HandleLinkState(state)
+				b.transactions.HandleLinkState(state)
+			}
+		}
+	}()
+	return b
+}
+
+func (b *bridge) waitStatus(t *testing.T, expected uavtalk.TelemetryStatus) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case status := <-b.statuses:
+			if status == expected {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("telemetry not %s", expected)
+		}
+	}
+}
+
+func TestSimulatorLink(t *testing.T) {
+	registry := testRegistry(t)
+	b := startBridge("sim://", registry)
+
+	b.waitStatus(t, uavtalk.TelemetryConnected)
+	if b.connection.Verified() == false {
+		t.Error("the firmware of the simulator is not identified")
+	}
+
+	var objects []uavtalk.ActiveObject
+	select {
+	case objects = <-b.sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("objects not enumerated")
+	}
+	var expected []*uavtalk.Definition
+	for _, definition := range registry.Definitions() {
+		if definition.MetaFor == nil {
+			expected = append(expected, definition)
+		}
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("%d objects enumerated, expected %d", len(objects), len(expected))
+	}
+	for i, object := range objects {
+		if object.Definition != expected[i] || object.Instances != 1 {
+			t.Errorf("object %d: %s, %d instances, expected %s, 1 instance", i, object.Definition.Name, object.Instances, expected[i].Name)
+		}
+	}
+
+	// the settings are acked, then read back
+	definition, err := registry.GetDefinitionForName("TestSettings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := uavtalk.NewPacket(definition, uavtalk.ObjectCmdWithAck, 0, map[string]interface{}{"Gain": float64(2.5)})
+	transaction, err := b.transactions.Send(write, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := transaction.Wait(); result.Status != uavtalk.TransactionAcked || result.Reply.Cmd != uavtalk.ObjectAck {
+		t.Fatalf("write %s: %v", result.Status, result.Err)
+	}
+
+	request := uavtalk.NewPacket(definition, uavtalk.ObjectRequest, 0, map[string]interface{}{})
+	transaction, err = b.transactions.Send(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := transaction.Wait()
+	if result.Status != uavtalk.TransactionAcked {
+		t.Fatalf("request %s: %v", result.Status, result.Err)
+	}
+	if gain := result.Reply.Data["Gain"]; gain != float32(2.5) {
+		t.Errorf("Gain %v read back, 2.5 written", gain)
+	}
+}
+
+// recordingLink is a simulator which keeps the packets written to it
+type recordingLink struct {
+	*Simulator
+	parser  *uavtalk.Parser
+	written chan *uavtalk.Packet
+}
+
+func (l *recordingLink) Write(b []byte) (int, error) {
+	packets, _ := l.parser.Feed(b)
+	for _, packet := range packets {
+		l.written <- packet
+	}
+	return l.Simulator.Write(b)
+}
+
+// recordingLinks are given by the simtest://<host> links
+var recordingLinks = struct {
+	sync.Mutex
+	hosts map[string]*recordingLink
+}{hosts: map[string]*recordingLink{}}
+
+func init() {
+	uavtalk.RegisterLink("simtest", func(uri *url.URL, registry *uavtalk.Registry) (uavtalk.Linker, error) {
+		recordingLinks.Lock()
+		defer recordingLinks.Unlock()
+		return recordingLinks.hosts[uri.Host], nil
+	})
+}
+
+func newRecordingLink(simulator *Simulator) (string, *recordingLink) {
+	recordingLinks.Lock()
+	defer recordingLinks.Unlock()
+	link := &recordingLink{simulator, uavtalk.NewParser(simulator.definitions.Registry), make(chan *uavtalk.Packet, 1000)}
+	host := fmt.Sprintf("sim%d", len(recordingLinks.hosts))
+	recordingLinks.hosts[host] = link
+	return "simtest://" + host, link
+}
+
+// the session reports the objects of the simulator with their number of instances, then finishes the enumeration
+func TestSimulatorSession(t *testing.T) {
+	registry := testRegistry(t)
+	simulator, err := New(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessory, err := registry.GetDefinitionForName("AccessoryDesired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulator.setObject(accessory, 2, map[string]interface{}{"AccessoryVal": float64(1)})
+
+	uri, link := newRecordingLink(simulator)
+	b := startBridge(uri, registry)
+
+	var objects []uavtalk.ActiveObject
+	select {
+	case objects = <-b.sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("objects not enumerated")
+	}
+
+	var expected []*uavtalk.Definition
+	for _, definition := range registry.Definitions() {
+		if definition.MetaFor == nil {
+			expected = append(expected, definition)
+		}
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("%d objects enumerated, expected %d", len(objects), len(expected))
+	}
+	for i, object := range objects {
+		instances := 1
+		if object.Definition == accessory {
+			instances = 3
+		}
+		if object.Definition != expected[i] || object.Instances != instances {
+			t.Errorf("object %d: %s, %d instances, expected %s, %d instances", i, object.Definition.Name, object.Instances, expected[i].Name, instances)
+		}
+	}
+
+	// the last SessionManaging written finishes the session
+	var last *uavtalk.Packet
+	for done := false; done == false; {
+		select {
+		case packet := <-link.written:
+			if packet.Definition.Name == "SessionManaging" && packet.Cmd == uavtalk.ObjectCmd {
+				last = packet
+			}
+		case <-time.After(100 * time.Millisecond):
+			done = true
+		}
+	}
+	if last == nil {
+		t.Fatal("no SessionManaging written")
+	}
+	if index := last.Data["ObjectOfInterestIndex"]; index != uint8(0xFF) {
+		t.Errorf("last SessionManaging written for index %v, expected 0xFF", index)
+	}
+	simulator.mutex.Lock()
+	current := simulator.sessionID
+	simulator.mutex.Unlock()
+	if sessionID := last.Data["SessionID"]; sessionID != current || current == 0 {
+		t.Errorf("session %v finished, the simulator is on session %d", sessionID, current)
+	}
+}
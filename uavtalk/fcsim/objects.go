@@ -0,0 +1,67 @@
+package fcsim
+
+import "github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+
+// normalizeData converts decoded values to the types expected for encoding, numbers are float64
+func normalizeData(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for name, value := range data {
+		result[name] = normalizeValue(value)
+	}
+	return result
+}
+
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = normalizeValue(value)
+		}
+		return values
+	case map[string]interface{}:
+		return normalizeData(v)
+	case string:
+		return v
+	}
+	return toFloat64(value)
+}
+
+func copyData(data map[string]interface{}) map[string]interface{} {
+	return normalizeData(data)
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// uavoHashOffset is the offset of the UAVO hash in FirmwareIAPObj.Description
+const uavoHashOffset = 60
+
+// setUAVOHash writes the UAVO hash in a FirmwareIAPObj Description, as the firmware does
+func setUAVOHash(description []interface{}, hash uavtalk.UAVOHash) {
+	if len(description) < uavoHashOffset+len(hash) {
+		return
+	}
+	for i, b := range hash {
+		description[uavoHashOffset+i] = float64(b)
+	}
+}
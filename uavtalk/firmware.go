@@ -0,0 +1,66 @@
+package uavtalk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+)
+
+/**
+ * Firmware identification.
+ * Tau Labs firmwares describe themselves in FirmwareIAPObj.Description (fw_version_info):
+ *	magic[4], commit hash[4], timestamp[4], board type, board revision, commit tag[26], firmware sha1[20], uavo sha1[20], padding
+ * The uavo sha1 is the UAVO hash of the definitions the firmware was built with, computed by version-info.py:
+ * the SHA1 of the hexadecimal SHA1s of each definition file, in file name order, files read with universal newlines.
+ */
+
+const firmwareIAPObjName = "FirmwareIAPObj"
+const firmwareUAVOHashOffset = 60
+
+// UAVOHash identifies a set of definitions
+type UAVOHash [sha1.Size]byte
+
+func (hash UAVOHash) String() string {
+	return hex.EncodeToString(hash[:])
+}
+
+// IsZero is true for firmwares built without the UAVO hash, and for definitions which were not loaded from files
+func (hash UAVOHash) IsZero() bool {
+	return hash == UAVOHash{}
+}
+
+// HashDefinitionFiles computes the UAVO hash of definition files, as version-info.py does
+func HashDefinitionFiles(files DefinitionFiles) UAVOHash {
+	hash := sha1.New()
+	for _, name := range files.Names() {
+		data := bytes.Replace(files[name], []byte("\r\n"), []byte("\n"), -1)
+		fileHash := sha1.Sum(data)
+		hash.Write([]byte(hex.EncodeToString(fileHash[:])))
+	}
+
+	var result UAVOHash
+	copy(result[:], hash.Sum(nil))
+	return result
+}
+
+// FirmwareUAVOHash extracts the UAVO hash from a FirmwareIAPObj packet
+func FirmwareUAVOHash(packet *Packet) (UAVOHash, error) {
+	var result UAVOHash
+	if packet.Definition.Name != firmwareIAPObjName {
+		return result, fmt.Errorf("%s is not %s", packet.Definition.Name, firmwareIAPObjName)
+	}
+
+	description, ok := packet.Data["Description"].([]interface{})
+	if ok == false || len(description) < firmwareUAVOHashOffset+len(result) {
+		return result, fmt.Errorf("%s: unexpected Description field", firmwareIAPObjName)
+	}
+	for i := range result {
+		b, ok := description[firmwareUAVOHashOffset+i].(uint8)
+		if ok == false {
+			return result, fmt.Errorf("%s: unexpected Description field", firmwareIAPObjName)
+		}
+		result[i] = b
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package uavtalk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * A Library holds several definition sets, eg. one per firmware revision running in a fleet,
+ * the Connection picks the one matching the UAVO hash reported by the firmware (see firmware.go).
+ */
+
+// Library is a collection of named registries
+type Library struct {
+	names      []string
+	registries []*Registry
+}
+
+// NewLibrary creates an empty library
+func NewLibrary() *Library {
+	return &Library{}
+}
+
+// Add adds a registry to the library, registries without UAVO hash can not be matched
+func (l *Library) Add(name string, registry *Registry) {
+	hash := registry.UAVOHash()
+	for i, other := range l.registries {
+		if hash.IsZero() == false && other.UAVOHash() == hash {
+			log.Warningf("Definitions %s and %s are the same (UAVO hash %s), %s is ignored", l.names[i], name, hash, name)
+			return
+		}
+	}
+	l.names = append(l.names, name)
+	l.registries = append(l.registries, registry)
+	log.Infof("Definitions %s, UAVO hash %s", name, hash)
+}
+
+// AddDirectory adds the definitions of dir, and of each of its sub directories
+func (l *Library) AddDirectory(dir string) error {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	dirs := []string{dir}
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, fileInfo.Name()))
+		}
+	}
+
+	for _, dir := range dirs {
+		files, err := ReadDefinitionFiles(dir)
+		if err != nil {
+			// not a definitions directory
+			continue
+		}
+		registry, err := NewRegistryFromFiles(files)
+		if err != nil {
+			return err
+		}
+		l.Add(dir, registry)
+	}
+	return nil
+}
+
+// Len returns the number of definition sets
+func (l *Library) Len() int {
+	return len(l.registries)
+}
+
+// Match returns the definitions matching the UAVO hash of a firmware
+func (l *Library) Match(hash UAVOHash) (string, *Registry, bool) {
+	if hash.IsZero() {
+		return "", nil, false
+	}
+	for i, registry := range l.registries {
+		if registry.UAVOHash() == hash {
+			return l.names[i], registry, true
+		}
+	}
+	return "", nil, false
+}
+
+// firmwareIAPObj returns a registry holding the FirmwareIAPObj definition, to identify the firmware
+func (l *Library) firmwareIAPObj() (*Registry, *Definition, bool) {
+	for _, registry := range l.registries {
+		if definition, err := registry.GetDefinitionForName(firmwareIAPObjName); err == nil {
+			return registry, definition, true
+		}
+	}
+	return nil, nil, false
+}
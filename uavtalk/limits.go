@@ -0,0 +1,227 @@
+package uavtalk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Field limits, as written in the limits attribute (or element) of the definitions, and checked by the Tau Labs GCS:
+ *	limits="%BE:0:100,%BE:0:100; %0401SM:50"
+ * Element limits are separated by commas, in element order, several limits of an element are separated by semicolons.
+ * A limit is a percent sign, an optional board type and revision (4 hexadecimal digits), a kind, and its values:
+ *	EQ: one of the values, NE: none of the values, BE: between the two values, BI: at least the value, SM: at most the value
+ * Values are numbers, or option names for enums.
+ * The board of the flight controller is not known, so board specific limits are parsed but not checked.
+ */
+
+// LimitKind is the kind of a limit, as written in the definitions
+type LimitKind string
+
+// limit kinds
+const (
+	LimitEqual    LimitKind = "EQ"
+	LimitNotEqual LimitKind = "NE"
+	LimitBetween  LimitKind = "BE"
+	LimitBigger   LimitKind = "BI"
+	LimitSmaller  LimitKind = "SM"
+)
+
+// Limit is a constraint on the value of a field element
+type Limit struct {
+	Kind   LimitKind     `json:"kind"`
+	Board  uint16        `json:"board"`  // board type and revision, 0 for all boards
+	Values []interface{} `json:"values"` // float64, or string for enums
+
+	options []string // of enum fields, options are ordered by index
+}
+
+func (limit *Limit) String() string {
+	values := make([]string, len(limit.Values))
+	for i, value := range limit.Values {
+		values[i] = fmt.Sprint(value)
+	}
+	switch limit.Kind {
+	case LimitEqual:
+		return fmt.Sprintf("one of %s", strings.Join(values, ", "))
+	case LimitNotEqual:
+		return fmt.Sprintf("none of %s", strings.Join(values, ", "))
+	case LimitBetween:
+		return fmt.Sprintf("between %s and %s", values[0], values[1])
+	case LimitBigger:
+		return fmt.Sprintf("at least %s", values[0])
+	}
+	return fmt.Sprintf("at most %s", values[0])
+}
+
+// check is true if value, as returned by FieldDefinition.Convert, is within the limit
+func (limit *Limit) check(value interface{}) bool {
+	equal := func(other interface{}) bool {
+		if option, ok := value.(string); ok {
+			return option == other
+		}
+		number, _ := numberToFloat64(value)
+		return number == other
+	}
+	// enums are compared by option index
+	number := func(value interface{}) float64 {
+		if option, ok := value.(string); ok {
+			return float64(indexOf(limit.options, option))
+		}
+		f, _ := numberToFloat64(value)
+		return f
+	}
+
+	switch limit.Kind {
+	case LimitEqual, LimitNotEqual:
+		found := false
+		for _, other := range limit.Values {
+			if equal(other) {
+				found = true
+			}
+		}
+		return found == (limit.Kind == LimitEqual)
+	case LimitBetween:
+		return number(value) >= number(limit.Values[0]) && number(value) <= number(limit.Values[1])
+	case LimitBigger:
+		return number(value) >= number(limit.Values[0])
+	}
+	return number(value) <= number(limit.Values[0])
+}
+
+// CheckLimits checks the values of data against the limits of the fields, missing values are not checked
+func (definition *Definition) CheckLimits(data map[string]interface{}) error {
+	for _, field := range definition.Fields {
+		path := fmt.Sprintf("%s.%s", definition.Name, field.Name)
+		var err error
+		field.forEachElement(data[field.Name], path, func(element int, path string, value interface{}) {
+			if err == nil {
+				err = field.checkElementLimits(element, path, value)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (field *FieldDefinition) checkElementLimits(element int, path string, value interface{}) error {
+	if element >= len(field.Limits) || value == nil {
+		return nil
+	}
+	converted, err := field.Convert(value)
+	if err != nil {
+		return &ValueError{path, value, err}
+	}
+	for _, limit := range field.Limits[element] {
+		if limit.Board == 0 && limit.check(converted) == false {
+			return &ValueError{path, value, fmt.Errorf("out of limits, expected %s", limit)}
+		}
+	}
+	return nil
+}
+
+// parseLimits parses the limits of a field, once its elements and options are known
+func (field *FieldDefinition) parseLimits() error {
+	limits := field.LimitsAttr
+	if len(limits) == 0 {
+		limits = field.LimitsElement
+	}
+	limits = strings.TrimSpace(limits)
+	if len(limits) == 0 {
+		return nil
+	}
+
+	elements := strings.Split(limits, ",")
+	if len(elements) > field.Elements {
+		return fmt.Errorf("%s: limits for %d elements, %d expected", field.Name, len(elements), field.Elements)
+	}
+
+	field.Limits = make([][]*Limit, len(elements))
+	for i, element := range elements {
+		for _, rule := range strings.Split(element, ";") {
+			rule = strings.TrimSpace(rule)
+			if len(rule) == 0 {
+				continue
+			}
+			limit, err := field.parseLimit(rule)
+			if err != nil {
+				return fmt.Errorf("%s: limit %q: %s", field.Name, rule, err)
+			}
+			field.Limits[i] = append(field.Limits[i], limit)
+		}
+	}
+	return nil
+}
+
+func (field *FieldDefinition) parseLimit(rule string) (*Limit, error) {
+	parts := strings.Split(rule, ":")
+	head := parts[0]
+	if strings.HasPrefix(head, "%") == false || (len(head) != 3 && len(head) != 7) {
+		return nil, fmt.Errorf("expected %%KIND or %%BOARDKIND")
+	}
+
+	limit := &Limit{Kind: LimitKind(head[len(head)-2:]), options: field.Options}
+	if len(head) == 7 {
+		board, err := strconv.ParseUint(head[1:5], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("bad board %s", head[1:5])
+		}
+		limit.Board = uint16(board)
+	}
+
+	expected := 1
+	switch limit.Kind {
+	case LimitEqual, LimitNotEqual:
+		expected = len(parts) - 1
+	case LimitBetween:
+		expected = 2
+	case LimitBigger, LimitSmaller:
+	default:
+		return nil, fmt.Errorf("unknown kind %s", limit.Kind)
+	}
+	if len(parts)-1 != expected || expected == 0 {
+		return nil, fmt.Errorf("%d values, %d expected", len(parts)-1, expected)
+	}
+
+	for _, s := range parts[1:] {
+		value, err := field.parseValue(s)
+		if err != nil {
+			return nil, err
+		}
+		limit.Values = append(limit.Values, value)
+	}
+	return limit, nil
+}
+
+// parseValue parses a value written in the definitions, a number, or an option name for enums
+func (field *FieldDefinition) parseValue(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if field.Type == "enum" {
+		if indexOf(field.Options, s) < 0 {
+			return nil, fmt.Errorf("unknown option %s", s)
+		}
+		return s, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		// eg. 0x20
+		integer, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", s)
+		}
+		value = float64(integer)
+	}
+	return value, nil
+}
+
+func indexOf(options []string, option string) int {
+	for i, other := range options {
+		if other == option {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,300 @@
+package uavtalk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testObject creates the definition of a settings object holding the given field elements
+func testObject(fields ...string) (*Definition, error) {
+	xml := fmt.Sprintf(`<xml>
+	<object name="Limited" singleinstance="true" settings="true" category="Test">
+		<description>Limits and defaults</description>
+		%s
+		<access gcs="readwrite" flight="readwrite"/>
+		<telemetrygcs acked="true" updatemode="onchange" period="0"/>
+		<telemetryflight acked="true" updatemode="onchange" period="0"/>
+		<logging updatemode="manual" period="0"/>
+	</object>
+</xml>`, strings.Join(fields, "\n"))
+
+	registry, err := NewRegistryFromFiles(DefinitionFiles{"limited.xml": []byte(xml)})
+	if err != nil {
+		return nil, err
+	}
+	return registry.GetDefinitionForName("Limited")
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		field    string
+		expected [][]Limit
+	}{
+		{
+			`<field name="F" units="" type="float" elements="1" limits="%BE:0:100"/>`,
+			[][]Limit{{{Kind: LimitBetween, Values: []interface{}{float64(0), float64(100)}}}},
+		},
+		{
+			`<field name="F" units="" type="int16" elements="1" limits="%EQ:1:2:3"/>`,
+			[][]Limit{{{Kind: LimitEqual, Values: []interface{}{float64(1), float64(2), float64(3)}}}},
+		},
+		{
+			`<field name="F" units="" type="int16" elements="1" limits="%NE:0"/>`,
+			[][]Limit{{{Kind: LimitNotEqual, Values: []interface{}{float64(0)}}}},
+		},
+		{
+			`<field name="F" units="" type="uint8" elements="1" limits="%BI:0x10"/>`,
+			[][]Limit{{{Kind: LimitBigger, Values: []interface{}{float64(16)}}}},
+		},
+		{
+			`<field name="F" units="" type="int8" elements="1" limits="%SM:-5"/>`,
+			[][]Limit{{{Kind: LimitSmaller, Values: []interface{}{float64(-5)}}}},
+		},
+		{
+			`<field name="F" units="" type="float" elements="1" limits="%BE:0:100; %0401SM:50"/>`,
+			[][]Limit{{
+				{Kind: LimitBetween, Values: []interface{}{float64(0), float64(100)}},
+				{Kind: LimitSmaller, Board: 0x0401, Values: []interface{}{float64(50)}},
+			}},
+		},
+		{
+			`<field name="F" units="" type="float" elementnames="Roll,Pitch,Yaw" limits="%BE:-1:1,,%BI:0"/>`,
+			[][]Limit{
+				{{Kind: LimitBetween, Values: []interface{}{float64(-1), float64(1)}}},
+				nil,
+				{{Kind: LimitBigger, Values: []interface{}{float64(0)}}},
+			},
+		},
+		{
+			`<field name="F" units="" type="enum" elements="1" options="Off,On,Auto" limits="%NE:Auto"/>`,
+			[][]Limit{{{Kind: LimitNotEqual, Values: []interface{}{"Auto"}}}},
+		},
+		{
+			`<field name="F" units="" type="float" elements="1"><limits>%BE:0:1</limits></field>`,
+			[][]Limit{{{Kind: LimitBetween, Values: []interface{}{float64(0), float64(1)}}}},
+		},
+		{
+			`<field name="F" units="" type="float" elements="1"/>`,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		definition, err := testObject(test.field)
+		if err != nil {
+			t.Errorf("%s: %s", test.field, err)
+			continue
+		}
+		field := definition.Fields[0]
+
+		limits := make([][]Limit, len(field.Limits))
+		for i, element := range field.Limits {
+			for _, limit := range element {
+				limit.options = nil
+				limits[i] = append(limits[i], *limit)
+			}
+		}
+		if len(field.Limits) == 0 {
+			limits = nil
+		}
+		if reflect.DeepEqual(limits, test.expected) == false {
+			t.Errorf("%s: limits %v, expected %v", test.field, limits, test.expected)
+		}
+	}
+}
+
+// a malformed limit or default value fails the whole definition
+func TestParseInvalidLimitsAndDefaults(t *testing.T) {
+	fields := []string{
+		`<field name="F" units="" type="float" elements="1" limits="BE:0:1"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%XX:1"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%BE:0"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%BE:0:1:2"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%EQ"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%SM:a"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%ZZZZSM:1"/>`,
+		`<field name="F" units="" type="float" elements="1" limits="%BI:0,%BI:0"/>`,
+		`<field name="F" units="" type="enum" elements="1" options="Off,On" limits="%EQ:Auto"/>`,
+		`<field name="F" units="" type="float" elements="1" defaultvalue="a"/>`,
+		`<field name="F" units="" type="float" elements="3" defaultvalue="1,2"/>`,
+		`<field name="F" units="" type="enum" elements="1" options="Off,On" defaultvalue="Auto"/>`,
+	}
+
+	for _, field := range fields {
+		if _, err := testObject(field); err == nil {
+			t.Errorf("%s: loaded", field)
+		}
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	definition, err := testObject(
+		`<field name="Gain" units="" type="float" elements="1" limits="%BE:0:10; %0401SM:5"/>`,
+		`<field name="Trim" units="" type="int16" elementnames="Roll,Pitch" limits="%BE:-100:100,%BI:0"/>`,
+		`<field name="Channels" units="" type="uint8" elements="2" limits="%NE:0,%EQ:1:2"/>`,
+		`<field name="Mode" units="" type="enum" elements="1" options="Off,Rate,Attitude,Auto" limits="%BE:Rate:Attitude"/>`,
+		`<field name="Free" units="" type="float" elements="1"/>`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		data map[string]interface{}
+		path string // of the element out of limits, empty if within limits
+	}{
+		{map[string]interface{}{"Gain": float64(10)}, ""},
+		// the board is not known, board specific limits are not checked
+		{map[string]interface{}{"Gain": float64(7)}, ""},
+		{map[string]interface{}{"Gain": float64(10.5)}, "Limited.Gain"},
+		{map[string]interface{}{"Gain": float64(-1)}, "Limited.Gain"},
+		{map[string]interface{}{"Gain": "a"}, "Limited.Gain"},
+		{map[string]interface{}{"Trim": map[string]interface{}{"Roll": float64(-100), "Pitch": float64(0)}}, ""},
+		{map[string]interface{}{"Trim": map[string]interface{}{"Roll": float64(-101)}}, "Limited.Trim.Roll"},
+		{map[string]interface{}{"Trim": map[string]interface{}{"Pitch": float64(-1)}}, "Limited.Trim.Pitch"},
+		{map[string]interface{}{"Channels": []interface{}{float64(3), float64(2)}}, ""},
+		{map[string]interface{}{"Channels": []interface{}{float64(0), float64(2)}}, "Limited.Channels[0]"},
+		{map[string]interface{}{"Channels": []interface{}{float64(3), float64(3)}}, "Limited.Channels[1]"},
+		{map[string]interface{}{"Mode": "Rate"}, ""},
+		{map[string]interface{}{"Mode": float64(2)}, ""},
+		{map[string]interface{}{"Mode": "Auto"}, "Limited.Mode"},
+		{map[string]interface{}{"Mode": "Off"}, "Limited.Mode"},
+		{map[string]interface{}{"Free": float64(-1e9)}, ""},
+		// missing values are not checked
+		{map[string]interface{}{}, ""},
+	}
+
+	for _, test := range tests {
+		err := definition.CheckLimits(test.data)
+		if len(test.path) == 0 {
+			if err != nil {
+				t.Errorf("%v: %s", test.data, err)
+			}
+			continue
+		}
+		valueError, ok := err.(*ValueError)
+		if ok == false {
+			t.Errorf("%v: %v, expected a *ValueError", test.data, err)
+			continue
+		}
+		if valueError.Path != test.path {
+			t.Errorf("%v: error on %s, expected %s", test.data, valueError.Path, test.path)
+		}
+	}
+}
+
+func TestDefaultData(t *testing.T) {
+	definition, err := testObject(
+		`<field name="Gain" units="" type="float" elements="1" defaultvalue="1.5"/>`,
+		`<field name="Trim" units="" type="int16" elementnames="Roll,Pitch,Yaw" defaultvalue="0,-5,0x10"/>`,
+		`<field name="Channels" units="" type="uint8" elements="3" defaultvalue="7"/>`,
+		`<field name="Mode" units="" type="enum" elements="1" options="Off,On" defaultvalue="On"/>`,
+		`<field name="Switch" units="" type="enum" elements="1" options="Off,On"/>`,
+		`<field name="Free" units="" type="float" elements="2"/>`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"Gain":     float64(1.5),
+		"Trim":     map[string]interface{}{"Roll": float64(0), "Pitch": float64(-5), "Yaw": float64(16)},
+		"Channels": []interface{}{float64(7), float64(7), float64(7)},
+		"Mode":     "On",
+		"Switch":   "Off",
+		"Free":     []interface{}{float64(0), float64(0)},
+	}
+	if data := definition.DefaultData(); reflect.DeepEqual(data, expected) == false {
+		t.Errorf("default data %v, expected %v", data, expected)
+	}
+}
+
+func TestFillMissing(t *testing.T) {
+	definition, err := testObject(
+		`<field name="Gain" units="" type="float" elements="1" defaultvalue="1"/>`,
+		`<field name="Rate" units="" type="float" elements="1" defaultvalue="2"/>`,
+		`<field name="Trim" units="" type="int16" elementnames="Roll,Pitch,Yaw" defaultvalue="1,2,3"/>`,
+		`<field name="Channels" units="" type="uint8" elements="2" defaultvalue="4"/>`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := map[string]interface{}{
+		"Gain":     float64(10),
+		"Trim":     map[string]interface{}{"Roll": float64(10), "Pitch": float64(20)},
+		"Channels": []interface{}{float64(1), float64(2)},
+	}
+
+	tests := []struct {
+		data     map[string]interface{}
+		current  map[string]interface{}
+		expected map[string]interface{}
+	}{
+		// data first, then the current values, then the defaults
+		{
+			map[string]interface{}{"Gain": float64(5)},
+			current,
+			map[string]interface{}{
+				"Gain":     float64(5),
+				"Rate":     float64(2),
+				"Trim":     map[string]interface{}{"Roll": float64(10), "Pitch": float64(20)},
+				"Channels": []interface{}{float64(1), float64(2)},
+			},
+		},
+		// named elements are completed one by one, arrays are taken as a whole
+		{
+			map[string]interface{}{
+				"Trim":     map[string]interface{}{"Pitch": float64(-1)},
+				"Channels": []interface{}{float64(9)},
+			},
+			current,
+			map[string]interface{}{
+				"Gain":     float64(10),
+				"Rate":     float64(2),
+				"Trim":     map[string]interface{}{"Roll": float64(10), "Pitch": float64(-1), "Yaw": float64(3)},
+				"Channels": []interface{}{float64(9)},
+			},
+		},
+		// nil values are missing values
+		{
+			map[string]interface{}{"Gain": nil, "Trim": map[string]interface{}{"Roll": nil}},
+			nil,
+			map[string]interface{}{
+				"Gain":     float64(1),
+				"Rate":     float64(2),
+				"Trim":     map[string]interface{}{"Roll": float64(1), "Pitch": float64(2), "Yaw": float64(3)},
+				"Channels": []interface{}{float64(4), float64(4)},
+			},
+		},
+		// fields unknown to the definition are kept, encoding ignores them
+		{
+			map[string]interface{}{"Other": "x"},
+			nil,
+			map[string]interface{}{
+				"Other":    "x",
+				"Gain":     float64(1),
+				"Rate":     float64(2),
+				"Trim":     map[string]interface{}{"Roll": float64(1), "Pitch": float64(2), "Yaw": float64(3)},
+				"Channels": []interface{}{float64(4), float64(4)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		data := make(map[string]interface{}, len(test.data))
+		for name, value := range test.data {
+			data[name] = value
+		}
+
+		result := definition.FillMissing(test.data, test.current)
+		if reflect.DeepEqual(result, test.expected) == false {
+			t.Errorf("%v completed to %v, expected %v", test.data, result, test.expected)
+		}
+		if reflect.DeepEqual(data, test.data) == false {
+			t.Errorf("%v modified to %v", data, test.data)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package uavtalk
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Links are selected with an URI, its scheme tells which LinkFactory has to create the link, eg:
+ *	hid://, hid://20a0:415b?serial=..., hid://?board=sparky2, hid://?path=...
+ *	tcp://host:port, tcp://:9000?mode=listen, with timeout=duration to dial or wait for the peer
+ *	udp://:9000, udp://:9000?peer=host:port, udp://:9000?peertimeout=30s
+ *	serial:///dev/ttyUSB0?baud=57600
+ *	replay://flight.opl?speed=2&loop=true, speed=max replays as fast as possible
+ * Any link can be captured to disk by adding capture=path (and optionally capturesize=bytes, captureage=duration) to its URI.
+ * Other packages can register their own schemes with RegisterLink.
+ */
+
+// DefaultLinkURI opens the first USB HID flight controller found
+const DefaultLinkURI = "hid://"
+
+// LinkFactory creates a Linker from a parsed URI, registry holds the definitions used on the link,
+// for the links which have to understand the packets (eg. the simulator)
+type LinkFactory func(uri *url.URL, registry *Registry) (Linker, error)
+
+var linkFactories = map[string]LinkFactory{}
+var linkFactoriesMutex sync.RWMutex
+
+// RegisterLink makes a LinkFactory available for a given URI scheme, registering the same scheme twice panics
+func RegisterLink(scheme string, factory LinkFactory) {
+	linkFactoriesMutex.Lock()
+	defer linkFactoriesMutex.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if factory == nil {
+		panic("uavtalk: RegisterLink factory is nil")
+	}
+	if _, exists := linkFactories[scheme]; exists {
+		panic(fmt.Sprintf("uavtalk: RegisterLink called twice for scheme %s", scheme))
+	}
+	linkFactories[scheme] = factory
+}
+
+// LinkSchemes returns the list of registered schemes
+func LinkSchemes() []string {
+	linkFactoriesMutex.RLock()
+	defer linkFactoriesMutex.RUnlock()
+
+	schemes := make([]string, 0, len(linkFactories))
+	for scheme := range linkFactories {
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+// NewLink creates a Linker from its URI
+func NewLink(uri string, registry *Registry) (Linker, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	linkFactoriesMutex.RLock()
+	factory, ok := linkFactories[strings.ToLower(u.Scheme)]
+	linkFactoriesMutex.RUnlock()
+	if ok == false {
+		return nil, fmt.Errorf("Unknown link scheme: %s (%s)", u.Scheme, uri)
+	}
+
+	link, err := factory(u, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	if capturePath := u.Query().Get("capture"); len(capturePath) > 0 {
+		config, err := captureConfigFromURI(u, capturePath)
+		if err != nil {
+			link.Close()
+			return nil, err
+		}
+		captured, err := NewCaptureLink(link, config)
+		if err != nil {
+			link.Close()
+			return nil, err
+		}
+		return captured, nil
+	}
+	return link, nil
+}
+
+// captureConfigFromURI reads the capture parameters, valid for any scheme: capture=path&capturesize=bytes&captureage=duration
+func captureConfigFromURI(uri *url.URL, path string) (CaptureConfig, error) {
+	config := CaptureConfig{Path: path}
+
+	if size := uri.Query().Get("capturesize"); len(size) > 0 {
+		var err error
+		if config.MaxSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return config, fmt.Errorf("Invalid capturesize parameter in link URI: %s", size)
+		}
+	}
+	if age := uri.Query().Get("captureage"); len(age) > 0 {
+		var err error
+		if config.MaxAge, err = time.ParseDuration(age); err != nil {
+			return config, fmt.Errorf("Invalid captureage parameter in link URI: %s", age)
+		}
+	}
+	return config, nil
+}
+
+func init() {
+	RegisterLink("hid", newUSBLinkFromURI)
+	RegisterLink("tcp", newTCPLinkFromURI)
+	RegisterLink("udp", newUDPLinkFromURI)
+	RegisterLink("serial", newSerialLinkFromURI)
+	RegisterLink("replay", newReplayLinkFromURI)
+}
+
+// uriPath returns what follows the scheme, so both serial:///dev/ttyUSB0 and serial://relative/path forms work
+func uriPath(uri *url.URL) string {
+	if len(uri.Opaque) > 0 {
+		return uri.Opaque
+	}
+	return uri.Host + uri.Path
+}
+
+func queryInt(uri *url.URL, name string, defaultValue int) (int, error) {
+	value := uri.Query().Get(name)
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s parameter in link URI: %s", name, value)
+	}
+	return result, nil
+}
+
+func newUSBLinkFromURI(uri *url.URL, _ *Registry) (Linker, error) {
+	selector := USBSelector{
+		Serial: uri.Query().Get("serial"),
+		Path:   uri.Query().Get("path"),
+		Board:  uri.Query().Get("board"),
+	}
+
+	if len(uri.Host) > 0 {
+		ids := strings.Split(uri.Host, ":")
+		if len(ids) != 2 {
+			return nil, fmt.Errorf("Invalid HID device, expected vendorID:productID, got %s", uri.Host)
+		}
+		vendorID, err := strconv.ParseUint(ids[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid HID vendorID: %s", ids[0])
+		}
+		productID, err := strconv.ParseUint(ids[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid HID productID: %s", ids[1])
+		}
+		selector.VendorID, selector.ProductID = uint16(vendorID), uint16(productID)
+	}
+	return NewUSBLink(selector)
+}
+
+func newTCPLinkFromURI(uri *url.URL, _ *Registry) (Linker, error) {
+	config := TCPConfig{Address: uri.Host}
+
+	switch mode := uri.Query().Get("mode"); mode {
+	case "", "dial":
+	case "listen":
+		config.Listen = true
+	default:
+		return nil, fmt.Errorf("Invalid TCP link mode: %s, expected dial or listen", mode)
+	}
+
+	if keepAlive := uri.Query().Get("keepalive"); len(keepAlive) > 0 {
+		var err error
+		if config.KeepAlive, err = time.ParseDuration(keepAlive); err != nil {
+			return nil, fmt.Errorf("Invalid keepalive parameter in link URI: %s", keepAlive)
+		}
+	}
+	if timeout := uri.Query().Get("timeout"); len(timeout) > 0 {
+		var err error
+		if config.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("Invalid timeout parameter in link URI: %s", timeout)
+		}
+	}
+	return NewTCPLink(config)
+}
+
+func newUDPLinkFromURI(uri *url.URL, _ *Registry) (Linker, error) {
+	config := UDPConfig{Address: uri.Host, Peer: uri.Query().Get("peer")}
+
+	if peerTimeout := uri.Query().Get("peertimeout"); len(peerTimeout) > 0 {
+		var err error
+		if config.PeerTimeout, err = time.ParseDuration(peerTimeout); err != nil {
+			return nil, fmt.Errorf("Invalid peertimeout parameter in link URI: %s", peerTimeout)
+		}
+	}
+	return NewUDPLink(config)
+}
+
+func newSerialLinkFromURI(uri *url.URL, _ *Registry) (Linker, error) {
+	config := SerialConfig{
+		Device: uriPath(uri),
+		Parity: uri.Query().Get("parity"),
+	}
+
+	var err error
+	if config.Baud, err = queryInt(uri, "baud", defaultSerialBaud); err != nil {
+		return nil, err
+	}
+	if config.StopBits, err = queryInt(uri, "stopbits", 1); err != nil {
+		return nil, err
+	}
+	return NewSerialLink(config)
+}
+
+func newReplayLinkFromURI(uri *url.URL, _ *Registry) (Linker, error) {
+	config := ReplayConfig{
+		Path:   uriPath(uri),
+		Format: uri.Query().Get("format"),
+		Speed:  1,
+	}
+
+	switch speed := uri.Query().Get("speed"); speed {
+	case "":
+	case "max":
+		config.Speed = 0
+	default:
+		var err error
+		if config.Speed, err = strconv.ParseFloat(speed, 64); err != nil {
+			return nil, fmt.Errorf("Invalid speed parameter in link URI: %s", speed)
+		}
+	}
+
+	if loop := uri.Query().Get("loop"); len(loop) > 0 {
+		var err error
+		if config.Loop, err = strconv.ParseBool(loop); err != nil {
+			return nil, fmt.Errorf("Invalid loop parameter in link URI: %s", loop)
+		}
+	}
+	return NewReplayLink(config)
+}
@@ -0,0 +1,207 @@
+package uavtalk
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// uritest:// links record the URI they were created from
+var uriTestLinks = struct {
+	sync.Mutex
+	uris  []*url.URL
+	links []*testLink
+}{}
+
+func init() {
+	RegisterLink("uritest", func(uri *url.URL, registry *Registry) (Linker, error) {
+		uriTestLinks.Lock()
+		defer uriTestLinks.Unlock()
+		link := newTestLink(false)
+		uriTestLinks.uris = append(uriTestLinks.uris, uri)
+		uriTestLinks.links = append(uriTestLinks.links, link)
+		return link, nil
+	})
+}
+
+// lastURITestLink returns the last uritest:// link created and the URI it was created from
+func lastURITestLink(t *testing.T) (*url.URL, *testLink) {
+	uriTestLinks.Lock()
+	defer uriTestLinks.Unlock()
+	if len(uriTestLinks.links) == 0 {
+		t.Fatal("no uritest link created")
+	}
+	last := len(uriTestLinks.links) - 1
+	return uriTestLinks.uris[last], uriTestLinks.links[last]
+}
+
+func isClosed(link *testLink) bool {
+	select {
+	case <-link.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestNewLinkErrors(t *testing.T) {
+	tests := []struct {
+		uri string
+		err string
+	}{
+		{"%zz", "invalid URL escape"},
+		{"nope://", "Unknown link scheme: nope"},
+		{"hid://20a0", "Invalid HID device"},
+		{"hid://12345:1234", "Invalid HID vendorID"},
+		{"hid://1234:12345", "Invalid HID productID"},
+		{"tcp://127.0.0.1:9000?mode=bogus", "Invalid TCP link mode: bogus"},
+		{"tcp://127.0.0.1:9000?keepalive=often", "Invalid keepalive parameter"},
+		{"tcp://127.0.0.1:9000?timeout=soon", "Invalid timeout parameter"},
+		{"udp://:9000?peertimeout=soon", "Invalid peertimeout parameter"},
+		{"serial:///dev/ttyUSB0?baud=fast", "Invalid baud parameter"},
+		{"serial:///dev/ttyUSB0?stopbits=one", "Invalid stopbits parameter"},
+		{"replay://flight.opl?speed=fast", "Invalid speed parameter"},
+		{"replay://flight.opl?loop=maybe", "Invalid loop parameter"},
+	}
+
+	for _, test := range tests {
+		link, err := NewLink(test.uri, nil)
+		if err == nil {
+			link.Close()
+			t.Errorf("%s: created a link, expected %q", test.uri, test.err)
+			continue
+		}
+		if strings.Contains(err.Error(), test.err) == false {
+			t.Errorf("%s: %s, expected %q", test.uri, err, test.err)
+		}
+	}
+}
+
+// valid parameters are passed on to the links
+func TestNewLinkParameters(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, uri := range []string{
+		"tcp://" + listener.Addr().String() + "?mode=dial&keepalive=30s&timeout=1s",
+		"udp://127.0.0.1:0?peer=127.0.0.1:9&peertimeout=30s",
+	} {
+		link, err := NewLink(uri, nil)
+		if err != nil {
+			t.Errorf("%s: %s", uri, err)
+			continue
+		}
+		switch l := link.(type) {
+		case *tcpLink:
+			if l.config.KeepAlive.Seconds() != 30 || l.config.Timeout.Seconds() != 1 || l.config.Listen {
+				t.Errorf("%s: TCP config %+v", uri, l.config)
+			}
+		case *udpLink:
+			if l.fixedPeer == false || l.peer.String() != "127.0.0.1:9" || l.peerTimeout.Seconds() != 30 {
+				t.Errorf("%s: UDP peer %s, fixed %t, timeout %s", uri, l.peer, l.fixedPeer, l.peerTimeout)
+			}
+		default:
+			t.Errorf("%s: %T created", uri, link)
+		}
+		link.Close()
+	}
+}
+
+func TestNewLinkScheme(t *testing.T) {
+	for _, uri := range []string{"uritest://vehicle/path?a=1&b=2", "UriTest://vehicle/path?a=1&b=2"} {
+		link, err := NewLink(uri, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", uri, err)
+		}
+		parsed, created := lastURITestLink(t)
+		if link != Linker(created) {
+			t.Errorf("%s: the link is not the one the factory created", uri)
+		}
+		if parsed.Host != "vehicle" || parsed.Path != "/path" || parsed.Query().Get("a") != "1" || parsed.Query().Get("b") != "2" {
+			t.Errorf("%s: factory called with %s", uri, parsed)
+		}
+		link.Close()
+	}
+
+	found := false
+	for _, scheme := range LinkSchemes() {
+		found = found || scheme == "uritest"
+	}
+	if found == false {
+		t.Errorf("uritest not in the link schemes %v", LinkSchemes())
+	}
+}
+
+func TestNewLinkCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavtalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.bin")
+
+	link, err := NewLink("uritest://vehicle?capture="+path+"&capturesize=1000&captureage=1m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captured, ok := link.(*captureLink)
+	if ok == false {
+		t.Fatalf("%T created, expected a capture", link)
+	}
+	_, created := lastURITestLink(t)
+	if captured.Linker != Linker(created) {
+		t.Error("the capture does not wrap the link the factory created")
+	}
+	if captured.config.Path != path || captured.config.MaxSize != 1000 || captured.config.MaxAge.Minutes() != 1 {
+		t.Errorf("capture config %+v", captured.config)
+	}
+	link.Close()
+
+	// the link is closed when its capture can't be created
+	for _, test := range []struct {
+		query string
+		err   string
+	}{
+		{"capture=" + path + "&capturesize=big", "Invalid capturesize parameter"},
+		{"capture=" + path + "&captureage=old", "Invalid captureage parameter"},
+		{"capture=" + filepath.Join(dir, "missing", "capture.bin"), "no such file or directory"},
+	} {
+		if link, err := NewLink("uritest://vehicle?"+test.query, nil); err == nil {
+			link.Close()
+			t.Errorf("%s: created a link, expected %q", test.query, test.err)
+		} else if strings.Contains(err.Error(), test.err) == false {
+			t.Errorf("%s: %s, expected %q", test.query, err, test.err)
+		}
+		if _, created := lastURITestLink(t); isClosed(created) == false {
+			t.Errorf("%s: link left open", test.query)
+		}
+	}
+}
+
+func TestRegisterLinkPanics(t *testing.T) {
+	factory := func(uri *url.URL, registry *Registry) (Linker, error) { return nil, nil }
+	for _, test := range []struct {
+		scheme  string
+		factory LinkFactory
+	}{
+		{"URITEST", factory},
+		{"uritest2", nil},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %s did not panic", test.scheme)
+				}
+			}()
+			RegisterLink(test.scheme, test.factory)
+		}()
+	}
+}
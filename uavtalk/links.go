@@ -2,15 +2,18 @@ package uavtalk
 
 import (
 	"errors"
+	"fmt"
 	"io"
-	"net"
+	"strings"
+	"sync"
 
 	"github.com/GeertJohan/go.hid"
+	log "github.com/Sirupsen/logrus"
 )
 
 /**
  * This file contains a simple abstraction layer for the telemetry link (eg. how are we connecting to the controller ?)
- * It currently supports USB HID and TCP links.
+ * It currently supports USB HID, serial, TCP and UDP links, and log replay, see NewLink.
  */
 
 type Linker interface {
@@ -19,55 +22,157 @@ type Linker interface {
 	io.Closer
 }
 
+// errLinkClosed is returned by the reads and writes of a closed link
+var errLinkClosed = errors.New("Link closed")
+
 type usbLink struct {
 	cc                     *hid.Device
 	fixedLengthWriteBuffer []byte
+
+	// hidapi does not support closing a device while it is being read or written
+	mutex  sync.RWMutex
+	closed bool
 }
 
-var _ Linker = (usbLink{})
+var _ Linker = (*usbLink)(nil)
 
 var deviceIDs = []struct {
 	vendorID  uint16
 	productID uint16
+	boards    []string
 }{
-	{vendorID: 0x20a0, productID: 0x415b}, // cc3d, flyingf4, sparky2
-	{vendorID: 0x20a0, productID: 0x4195}, // flyingf3
-	{vendorID: 0x20a0, productID: 0x41d0}, // sparky
-	{vendorID: 0x20a0, productID: 0x415c}, // taulink, does it mean anything to put it here ? pipxtreme
-	{vendorID: 0x20a0, productID: 0x4235}, // colibri
-	{vendorID: 0x0fda, productID: 0x0100}, // quanton
+	{vendorID: 0x20a0, productID: 0x415b, boards: []string{"cc3d", "flyingf4", "sparky2"}},
+	{vendorID: 0x20a0, productID: 0x4195, boards: []string{"flyingf3"}},
+	{vendorID: 0x20a0, productID: 0x41d0, boards: []string{"sparky"}},
+	{vendorID: 0x20a0, productID: 0x415c, boards: []string{"taulink", "pipxtreme"}}, // does it mean anything to put it here ?
+	{vendorID: 0x20a0, productID: 0x4235, boards: []string{"colibri"}},
+	{vendorID: 0x0fda, productID: 0x0100, boards: []string{"quanton"}},
+}
+
+// USBDevice describes a supported board found on USB
+type USBDevice struct {
+	Path         string
+	VendorID     uint16
+	ProductID    uint16
+	Serial       string
+	Manufacturer string
+	Product      string
+	Boards       []string // boards using this vendorID/productID pair
+}
+
+func (device USBDevice) String() string {
+	return fmt.Sprintf("%04x:%04x %s %s (serial: %s, boards: %s, path: %s)", device.VendorID, device.ProductID,
+		device.Manufacturer, device.Product, device.Serial, strings.Join(device.Boards, "/"), device.Path)
+}
+
+// matchesBoard tells if the device can be the given board,
+// boards sharing the same USB IDs are told apart with the product string when possible.
+func (device USBDevice) matchesBoard(board string) bool {
+	board = strings.ToLower(board)
+	product := strings.ToLower(device.Product)
+
+	found := false
+	for _, b := range device.Boards {
+		if b == board {
+			found = true
+		} else if len(product) > 0 && strings.Contains(product, b) {
+			return false
+		}
+	}
+	return found
 }
 
-func NewUSBLink() (Linker, error) {
+// USBSelector pins the board to open, zero values match any device
+type USBSelector struct {
+	VendorID  uint16
+	ProductID uint16
+	Serial    string
+	Path      string
+	Board     string // eg. sparky2, see deviceIDs
+}
+
+func (selector USBSelector) matches(device USBDevice) bool {
+	if selector.VendorID != 0 && selector.VendorID != device.VendorID {
+		return false
+	}
+	if selector.ProductID != 0 && selector.ProductID != device.ProductID {
+		return false
+	}
+	if len(selector.Serial) > 0 && selector.Serial != device.Serial {
+		return false
+	}
+	if len(selector.Path) > 0 && selector.Path != device.Path {
+		return false
+	}
+	if len(selector.Board) > 0 && device.matchesBoard(selector.Board) == false {
+		return false
+	}
+	return true
+}
+
+// EnumerateUSBDevices lists all the supported boards currently plugged
+func EnumerateUSBDevices() ([]USBDevice, error) {
 	devices, err := hid.Enumerate(0x00, 0x00)
 	if err != nil {
 		return nil, err
 	}
 
-	var deviceIDIndex = -1
-Loop:
+	result := make([]USBDevice, 0, len(devices))
 	for _, device := range devices {
-		for index, deviceID := range deviceIDs {
+		for _, deviceID := range deviceIDs {
 			if device.VendorId == deviceID.vendorID && device.ProductId == deviceID.productID {
-				deviceIDIndex = index
-				break Loop
+				result = append(result, USBDevice{
+					Path:         device.Path,
+					VendorID:     device.VendorId,
+					ProductID:    device.ProductId,
+					Serial:       device.SerialNumber,
+					Manufacturer: device.Manufacturer,
+					Product:      device.Product,
+					Boards:       deviceID.boards,
+				})
+				break
 			}
 		}
 	}
-	if deviceIDIndex == -1 {
+	return result, nil
+}
+
+// NewUSBLink opens the first supported board matching selector
+func NewUSBLink(selector USBSelector) (Linker, error) {
+	devices, err := EnumerateUSBDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]USBDevice, 0, len(devices))
+	for _, device := range devices {
+		if selector.matches(device) {
+			candidates = append(candidates, device)
+		}
+	}
+	if len(candidates) == 0 {
 		return nil, errors.New("No suitable device found")
 	}
 
-	device := deviceIDs[deviceIDIndex]
-	cc, err := hid.Open(device.vendorID, device.productID, "")
+	if len(candidates) > 1 {
+		log.Warningf("%d boards found, using %s, select one by serial, path or board", len(candidates), candidates[0])
+	}
+
+	cc, err := hid.OpenPath(candidates[0].Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return usbLink{cc, make([]byte, MaxHIDFrameSize)}, nil
+	return &usbLink{cc: cc, fixedLengthWriteBuffer: make([]byte, MaxHIDFrameSize)}, nil
 }
 
-func (l usbLink) Write(b []byte) (int, error) {
+func (l *usbLink) Write(b []byte) (int, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		return 0, errLinkClosed
+	}
+
 	currentOffset := 0
 	for currentOffset < len(b) {
 		toWriteLength := len(b) - currentOffset
@@ -92,7 +197,13 @@ func (l usbLink) Write(b []byte) (int, error) {
 	return currentOffset, nil
 }
 
-func (l usbLink) Read(b []byte) (int, error) {
+func (l *usbLink) Read(b []byte) (int, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		return 0, errLinkClosed
+	}
+
 	n, err := l.cc.ReadTimeout(b, 50)
 	if err != nil {
 		return 0, err
@@ -106,15 +217,12 @@ func (l usbLink) Read(b []byte) (int, error) {
 	return s, nil
 }
 
-func (l usbLink) Close() error {
-	l.cc.Close()
+func (l *usbLink) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed == false {
+		l.closed = true
+		l.cc.Close()
+	}
 	return nil
 }
-
-type tcpLink net.Conn
-
-var _ Linker = (tcpLink)(nil)
-
-func NewTCPLink() (Linker, error) {
-	return net.Dial("tcp", "localhost:9000")
-}
@@ -3,7 +3,6 @@ package uavtalk
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 )
 
@@ -16,56 +15,34 @@ func valueForEnumString(field *FieldDefinition, option string) (uint8, error) {
 	return 0, fmt.Errorf("%s enum option not found", option)
 }
 
-func writeToUAVTalk(field *FieldDefinition, writer *bytes.Buffer, value interface{}) error {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f", r)
-		}
-	}()
-	typeInfo := field.FieldTypeInfo
-	var result interface{}
-	switch typeInfo.Name {
-	case "int8":
-		result = uint8(value.(float64))
-	case "int16":
-		result = int16(value.(float64))
-	case "int32":
-		result = int32(value.(float64))
-	case "uint8":
-		result = uint8(value.(float64))
-	case "uint16":
-		result = uint16(value.(float64))
-	case "uint32":
-		result = uint32(value.(float64))
-	case "float":
-		result = float32(value.(float64))
-	case "enum":
-		var err error
-		if result, err = valueForEnumString(field, value.(string)); err != nil {
-			return err
-		}
-	}
-	if result == nil {
-		return errors.New("Could not read from typeInfo.")
+func writeToUAVTalk(field *FieldDefinition, path string, writer *bytes.Buffer, value interface{}) error {
+	result, err := field.Convert(value)
+	if err != nil {
+		return &ValueError{path, value, err}
 	}
 
-	if err := binary.Write(writer, binary.LittleEndian, result); err != nil {
-		return err
+	if option, ok := result.(string); ok {
+		if result, err = valueForEnumString(field, option); err != nil {
+			return &ValueError{path, value, err}
+		}
 	}
 
-	return nil
+	return binary.Write(writer, binary.LittleEndian, result)
 }
 
-func interfaceToUAVTalk(field *FieldDefinition, writer *bytes.Buffer, value interface{}) error {
+func interfaceToUAVTalk(field *FieldDefinition, path string, writer *bytes.Buffer, value interface{}) error {
 	if field.Elements > 1 && len(field.ElementNames) == 0 {
 		valueArray, ok := value.([]interface{})
 
 		if ok == false {
-			return fmt.Errorf("Value for %s should be a map of fields with Elements > 1", field.Name)
+			return &ValueError{path, value, fmt.Errorf("expects an array of %d elements", field.Elements)}
+		}
+		if len(valueArray) != field.Elements {
+			return &ValueError{path, value, fmt.Errorf("expects %d elements, got %d", field.Elements, len(valueArray))}
 		}
 
-		for _, value := range valueArray {
-			if err := writeToUAVTalk(field, writer, value); err != nil {
+		for i, value := range valueArray {
+			if err := writeToUAVTalk(field, fmt.Sprintf("%s[%d]", path, i), writer, value); err != nil {
 				return err
 			}
 		}
@@ -73,17 +50,17 @@ func interfaceToUAVTalk(field *FieldDefinition, writer *bytes.Buffer, value inte
 		valueMap, ok := value.(map[string]interface{})
 
 		if ok == false {
-			return fmt.Errorf("Value for %s should be a map of fields with Elements > 1", field.Name)
+			return &ValueError{path, value, fmt.Errorf("expects a map of %v", field.ElementNames)}
 		}
 
 		for _, name := range field.ElementNames {
 			value := valueMap[name]
-			if err := writeToUAVTalk(field, writer, value); err != nil {
+			if err := writeToUAVTalk(field, fmt.Sprintf("%s.%s", path, name), writer, value); err != nil {
 				return err
 			}
 		}
 	} else {
-		if err := writeToUAVTalk(field, writer, value); err != nil {
+		if err := writeToUAVTalk(field, path, writer, value); err != nil {
 			return err
 		}
 	}
@@ -93,7 +70,8 @@ func interfaceToUAVTalk(field *FieldDefinition, writer *bytes.Buffer, value inte
 func mapToUAVTalk(uavdef *Definition, data map[string]interface{}) ([]byte, error) {
 	writer := new(bytes.Buffer)
 	for _, field := range uavdef.Fields {
-		if err := interfaceToUAVTalk(field, writer, data[field.Name]); err != nil {
+		path := fmt.Sprintf("%s.%s", uavdef.Name, field.Name)
+		if err := interfaceToUAVTalk(field, path, writer, data[field.Name]); err != nil {
 			return nil, err
 		}
 	}
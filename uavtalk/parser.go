@@ -0,0 +1,284 @@
+package uavtalk
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+/**
+ * Byte level UAVTalk parser, following the state machine of uavtalk.cpp in GCS:
+ *	sync -> type -> length -> objID -> instID -> timestamp -> data -> CRC
+ * instID is only present for multi instance objects, timestamp for timestamped packets (type flag 0x80).
+ * Each field is validated as soon as it is complete (version, type, length against the object definition),
+ * when something is wrong the parser goes back to looking for a sync byte,
+ * starting right after the sync byte of the rejected packet, so a real packet hidden in garbage is not lost.
+ */
+
+// ParserState is the part of the packet the parser is waiting for
+type ParserState int
+
+const (
+	StateSync ParserState = iota
+	StateType
+	StateLength
+	StateObjectID
+	StateInstanceID
+	StateTimestamp
+	StateData
+	StateCRC
+	StateDecode // not a parsing state, counts packets that could not be decoded
+	parserStateCount
+)
+
+var parserStateNames = [parserStateCount]string{"sync", "type", "length", "objectID", "instanceID", "timestamp", "data", "crc", "decode"}
+
+func (state ParserState) String() string {
+	if state < 0 || state >= parserStateCount {
+		return fmt.Sprintf("ParserState(%d)", int(state))
+	}
+	return parserStateNames[state]
+}
+
+// ParseError is returned for packets rejected on crc, or that could not be decoded
+type ParseError struct {
+	State ParserState
+	Frame []byte
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.State, e.Err)
+}
+
+// Parser reassembles packets from a byte stream, it is not safe for concurrent use, except for the counters
+type Parser struct {
+	// first in the struct for 64 bits alignment of atomic operations
+	errors  [parserStateCount]uint64
+	packets uint64
+
+	registry  *Registry
+	maxLength int
+
+	state      ParserState
+	frame      []byte
+	length     int
+	definition *Definition
+}
+
+// NewParser creates a parser for the definitions of registry
+func NewParser(registry *Registry) *Parser {
+	return &Parser{
+		registry:  registry,
+		maxLength: registry.MaxUAVObjectLength(),
+		frame:     make([]byte, 0, 256),
+	}
+}
+
+// setRegistry changes the definitions, it must not be called while the parser is fed
+func (p *Parser) setRegistry(registry *Registry) {
+	p.registry = registry
+	p.maxLength = registry.MaxUAVObjectLength()
+	p.Reset()
+}
+
+// Reset drops the packet being parsed, counters are kept
+func (p *Parser) Reset() {
+	p.state = StateSync
+	p.frame = p.frame[:0]
+}
+
+// ErrorCount returns the number of errors which occurred in state, for StateSync it is the number of bytes skipped
+func (p *Parser) ErrorCount(state ParserState) uint64 {
+	return atomic.LoadUint64(&p.errors[state])
+}
+
+// ErrorCounts returns all the error counters, by state name
+func (p *Parser) ErrorCounts() map[string]uint64 {
+	counts := make(map[string]uint64, parserStateCount)
+	for state := StateSync; state < parserStateCount; state++ {
+		counts[state.String()] = p.ErrorCount(state)
+	}
+	return counts
+}
+
+// PacketCount returns the number of packets successfully decoded
+func (p *Parser) PacketCount() uint64 {
+	return atomic.LoadUint64(&p.packets)
+}
+
+// Feed parses data, which can hold any number of packets or parts of packets,
+// returns the packets completed and the errors for the packets which were rejected on crc or could not be decoded.
+func (p *Parser) Feed(data []byte) ([]*Packet, []error) {
+	var packets []*Packet
+	var errs []error
+	p.feed(data, func(packet *Packet, err error) {
+		if packet != nil {
+			packets = append(packets, packet)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return packets, errs
+}
+
+// feed parses data, giving the packets completed and the errors to handle, in the order they come in the stream
+func (p *Parser) feed(data []byte, handle func(packet *Packet, err error)) {
+	queue := data
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+
+		packet, err, ok := p.step(b)
+		if packet != nil || err != nil {
+			handle(packet, err)
+		}
+		if ok == false {
+			// resync, on what followed the sync byte of the rejected packet
+			resync := make([]byte, len(p.frame)-1, len(p.frame)-1+len(queue))
+			copy(resync, p.frame[1:])
+			queue = append(resync, queue...)
+			p.Reset()
+		}
+	}
+}
+
+// fail counts an error for the current state, the packet being parsed is rejected
+func (p *Parser) fail(format string, args ...interface{}) (*Packet, error, bool) {
+	atomic.AddUint64(&p.errors[p.state], 1)
+	if p.state == StateCRC {
+		frame := make([]byte, len(p.frame))
+		copy(frame, p.frame)
+		return nil, &ParseError{p.state, frame, fmt.Errorf(format, args...)}, false
+	}
+	return nil, nil, false
+}
+
+// step handles one byte, ok is false when the packet being parsed is rejected
+func (p *Parser) step(b byte) (packet *Packet, err error, ok bool) {
+	if p.state == StateSync {
+		if b != syncByte {
+			atomic.AddUint64(&p.errors[StateSync], 1)
+			return nil, nil, true
+		}
+		p.frame = append(p.frame[:0], b)
+		p.state = StateType
+		return nil, nil, true
+	}
+
+	p.frame = append(p.frame, b)
+
+	switch p.state {
+	case StateType:
+		if b&^(typeMask|timestampedMask) != versionMask {
+			return p.fail("Wrong version: %.02x", b)
+		}
+		if b&typeMask > ObjectNack {
+			return p.fail("Unknown type: %.02x", b)
+		}
+		if b&timestampedMask != 0 && b&typeMask != ObjectCmd && b&typeMask != ObjectCmdWithAck {
+			return p.fail("Unknown timestamped type: %.02x", b)
+		}
+		p.state = StateLength
+
+	case StateLength:
+		if len(p.frame) < 4 {
+			break
+		}
+		p.length = int(byteArrayToInt16(p.frame[2:4]))
+		if p.length < shortHeaderLength || p.length > p.maxLength+timestampLength {
+			return p.fail("Wrong length: %d", p.length)
+		}
+		p.state = StateObjectID
+
+	case StateObjectID:
+		if len(p.frame) < shortHeaderLength {
+			break
+		}
+		objectID := byteArrayToInt32(p.frame[4:8])
+		definition, err := p.registry.GetDefinitionForObjectID(objectID)
+		if err != nil {
+			return p.fail("%s", err)
+		}
+		if expected := p.expectedLength(definition, p.frame[1]); p.length != expected {
+			return p.fail("Wrong length for %s: %d, expected %d", definition.Name, p.length, expected)
+		}
+		p.definition = definition
+		p.nextState()
+
+	case StateInstanceID:
+		if len(p.frame) < shortHeaderLength+2 {
+			break
+		}
+		p.nextState()
+
+	case StateTimestamp:
+		if len(p.frame) < p.headerLength() {
+			break
+		}
+		p.nextState()
+
+	case StateData:
+		if len(p.frame) < p.length {
+			break
+		}
+		p.state = StateCRC
+
+	case StateCRC:
+		if b != computeCrc8(0, p.frame[:p.length]) {
+			return p.fail("Wrong crc8")
+		}
+
+		packet, err := newPacketFromBinary(p.registry, p.frame)
+		p.Reset()
+		if err != nil {
+			atomic.AddUint64(&p.errors[StateDecode], 1)
+			return nil, &ParseError{StateDecode, nil, err}, true
+		}
+		atomic.AddUint64(&p.packets, 1)
+		return packet, nil, true
+	}
+	return nil, nil, true
+}
+
+// nextState moves on once the header field in the current state is complete
+func (p *Parser) nextState() {
+	timestamped := p.frame[1]&timestampedMask != 0
+	switch {
+	case p.state == StateObjectID && p.definition.SingleInstance == false:
+		p.state = StateInstanceID
+	case p.state != StateTimestamp && timestamped:
+		p.state = StateTimestamp
+	case len(p.frame) < p.length:
+		p.state = StateData
+	default:
+		p.state = StateCRC
+	}
+}
+
+// headerLength returns the length of the header of the packet being parsed
+func (p *Parser) headerLength() int {
+	length := shortHeaderLength
+	if p.definition.SingleInstance == false {
+		length += 2
+	}
+	if p.frame[1]&timestampedMask != 0 {
+		length += timestampLength
+	}
+	return length
+}
+
+// expectedLength returns the length of a packet, crc excluded, for a definition and a packet type byte
+func (p *Parser) expectedLength(definition *Definition, packetType uint8) int {
+	length := shortHeaderLength
+	if definition.SingleInstance == false {
+		length += 2
+	}
+	if packetType&timestampedMask != 0 {
+		length += timestampLength
+	}
+	if cmd := packetType & typeMask; cmd == ObjectCmd || cmd == ObjectCmdWithAck {
+		length += definition.Fields.ByteLength()
+	}
+	return length
+}
@@ -0,0 +1,218 @@
+package uavtalk
+
+import (
+	"testing"
+)
+
+// testRegistry loads the definitions of testdata/definitions
+func testRegistry(t *testing.T) *Registry {
+	registry, err := LoadRegistry("testdata/definitions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// testFrame encodes a packet as sent on the link
+func testFrame(t *testing.T, packet *Packet) []byte {
+	frame, err := packet.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func testDefinition(t *testing.T, registry *Registry, name string) *Definition {
+	definition, err := registry.GetDefinitionForName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return definition
+}
+
+func concat(chunks ...[]byte) []byte {
+	var data []byte
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+func TestParserFeed(t *testing.T) {
+	registry := testRegistry(t)
+	stats := testDefinition(t, registry, "FlightTelemetryStats")
+	accessory := testDefinition(t, registry, "AccessoryDesired")
+
+	statsData := map[string]interface{}{
+		"TxDataRate": float64(1), "RxDataRate": float64(2), "TxFailures": float64(3), "RxFailures": float64(4),
+		"TxRetries": float64(5), "Status": "Connected",
+	}
+	statsFrame := testFrame(t, NewPacket(stats, ObjectCmd, 0, statsData))
+	requestFrame := testFrame(t, NewPacket(stats, ObjectRequest, 0, map[string]interface{}{}))
+	accessoryFrame := testFrame(t, NewPacket(accessory, ObjectCmdWithAck, 3, map[string]interface{}{"AccessoryVal": float64(0.5)}))
+	timestampedFrame := testFrame(t, NewTimestampedPacket(stats, ObjectCmd, 0, 0xbeef, statsData))
+	timestampedAccessoryFrame := testFrame(t, NewTimestampedPacket(accessory, ObjectCmd, 7, 42, map[string]interface{}{"AccessoryVal": float64(1)}))
+
+	badCRC := append([]byte{}, statsFrame...)
+	badCRC[len(badCRC)-1]++
+
+	// a timestamped type on a request is not valid
+	badTimestampedType := append([]byte{}, requestFrame...)
+	badTimestampedType[1] |= timestampedMask
+
+	type expectedPacket struct {
+		name        string
+		cmd         uint8
+		instanceID  uint16
+		timestamped bool
+		timestamp   uint16
+	}
+
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		packets []expectedPacket
+		errors  map[ParserState]uint64
+	}{
+		{
+			name:    "single frame",
+			chunks:  [][]byte{statsFrame},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+		},
+		{
+			name:    "frame split across feeds",
+			chunks:  [][]byte{statsFrame[:1], statsFrame[1:3], statsFrame[3:9], statsFrame[9:]},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+		},
+		{
+			name:    "one byte at a time",
+			chunks:  splitBytes(accessoryFrame),
+			packets: []expectedPacket{{"AccessoryDesired", ObjectCmdWithAck, 3, false, 0}},
+		},
+		{
+			name:    "several frames in one feed",
+			chunks:  [][]byte{concat(requestFrame, accessoryFrame, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectRequest, 0, false, 0}, {"AccessoryDesired", ObjectCmdWithAck, 3, false, 0}, {"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+		},
+		{
+			name:    "garbage before the sync byte",
+			chunks:  [][]byte{concat([]byte{0x00, 0xff, 0x12}, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateSync: 3},
+		},
+		{
+			name:    "sync byte in garbage",
+			chunks:  [][]byte{concat([]byte{syncByte, 0x00}, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateType: 1, StateSync: 1},
+		},
+		{
+			name:    "bad crc then a valid frame",
+			chunks:  [][]byte{concat(badCRC, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateCRC: 1, StateSync: uint64(len(badCRC) - 1)},
+		},
+		{
+			name:   "truncated header",
+			chunks: [][]byte{statsFrame[:6]},
+		},
+		{
+			name:    "truncated header then a valid frame",
+			chunks:  [][]byte{concat(statsFrame[:6], statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateObjectID: 1, StateSync: 5},
+		},
+		{
+			name:    "wrong length",
+			chunks:  [][]byte{concat([]byte{syncByte, versionMask, 0xff, 0xff}, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateLength: 1, StateSync: 3},
+		},
+		{
+			name:    "unknown object",
+			chunks:  [][]byte{concat([]byte{syncByte, versionMask, shortHeaderLength, 0x00, 0x01, 0x02, 0x03, 0x04}, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateObjectID: 1, StateSync: 7},
+		},
+		{
+			name:    "timestamped frames",
+			chunks:  [][]byte{concat(timestampedFrame, timestampedAccessoryFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, true, 0xbeef}, {"AccessoryDesired", ObjectCmd, 7, true, 42}},
+		},
+		{
+			name:    "timestamped frame split across feeds",
+			chunks:  [][]byte{timestampedAccessoryFrame[:9], timestampedAccessoryFrame[9:11], timestampedAccessoryFrame[11:]},
+			packets: []expectedPacket{{"AccessoryDesired", ObjectCmd, 7, true, 42}},
+		},
+		{
+			name:    "timestamped request",
+			chunks:  [][]byte{concat(badTimestampedType, statsFrame)},
+			packets: []expectedPacket{{"FlightTelemetryStats", ObjectCmd, 0, false, 0}},
+			errors:  map[ParserState]uint64{StateType: 1, StateSync: uint64(len(badTimestampedType) - 1)},
+		},
+	}
+
+	for _, test := range tests {
+		parser := NewParser(registry)
+		var packets []*Packet
+		var errs []error
+		for _, chunk := range test.chunks {
+			p, e := parser.Feed(chunk)
+			packets = append(packets, p...)
+			errs = append(errs, e...)
+		}
+
+		if len(packets) != len(test.packets) {
+			t.Errorf("%s: %d packets, expected %d", test.name, len(packets), len(test.packets))
+			continue
+		}
+		for i, expected := range test.packets {
+			packet := packets[i]
+			if packet.Definition.Name != expected.name || packet.Cmd != expected.cmd || packet.InstanceID != expected.instanceID ||
+				packet.Timestamped != expected.timestamped || packet.Timestamp != expected.timestamp {
+				t.Errorf("%s: packet %d is %s cmd %d instance %d timestamped %v %d, expected %+v", test.name, i,
+					packet.Definition.Name, packet.Cmd, packet.InstanceID, packet.Timestamped, packet.Timestamp, expected)
+			}
+		}
+		if parser.PacketCount() != uint64(len(test.packets)) {
+			t.Errorf("%s: packet count %d, expected %d", test.name, parser.PacketCount(), len(test.packets))
+		}
+
+		for state := StateSync; state < parserStateCount; state++ {
+			if count := parser.ErrorCount(state); count != test.errors[state] {
+				t.Errorf("%s: %d %s errors, expected %d", test.name, count, state, test.errors[state])
+			}
+		}
+		if crcErrors := test.errors[StateCRC]; uint64(len(errs)) != crcErrors {
+			t.Errorf("%s: %d errors returned, expected %d: %v", test.name, len(errs), crcErrors, errs)
+		}
+	}
+}
+
+func TestParserDecodesFields(t *testing.T) {
+	registry := testRegistry(t)
+	stats := testDefinition(t, registry, "FlightTelemetryStats")
+
+	frame := testFrame(t, NewTimestampedPacket(stats, ObjectCmd, 0, 1000, map[string]interface{}{
+		"TxDataRate": float64(1.5), "RxDataRate": float64(2), "TxFailures": float64(3), "RxFailures": float64(4),
+		"TxRetries": float64(5), "Status": "HandshakeAck",
+	}))
+	packets, errs := NewParser(registry).Feed(frame)
+	if len(packets) != 1 || len(errs) != 0 {
+		t.Fatalf("%d packets, errors: %v", len(packets), errs)
+	}
+	if status := packets[0].Data["Status"]; status != "HandshakeAck" {
+		t.Errorf("Status %v, expected HandshakeAck", status)
+	}
+	if failures := packets[0].Data["TxFailures"]; failures != uint32(3) {
+		t.Errorf("TxFailures %v (%T), expected 3", failures, failures)
+	}
+}
+
+func splitBytes(data []byte) [][]byte {
+	chunks := make([][]byte, len(data))
+	for i := range data {
+		chunks[i] = data[i : i+1]
+	}
+	return chunks
+}
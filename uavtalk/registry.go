@@ -0,0 +1,108 @@
+package uavtalk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/**
+ * A Registry holds a set of definitions, as loaded from a directory of UAVObject XML files,
+ * indexed by object ID and by name. Nothing is global, several registries can be used side by side,
+ * eg. to talk to flight controllers running different firmwares.
+ * A Registry is not modified once created, it can be shared between goroutines.
+ */
+
+// Registry is a set of definitions
+type Registry struct {
+	definitions        Definitions
+	byID               map[uint32]*Definition
+	byName             map[string]*Definition
+	maxUAVObjectLength int
+	uavoHash           UAVOHash
+}
+
+// NewRegistry indexes definitions, meta definitions have to be in the slice too, object IDs and names must be unique
+func NewRegistry(definitions Definitions) (*Registry, error) {
+	r := &Registry{
+		definitions:        definitions,
+		byID:               make(map[uint32]*Definition, len(definitions)),
+		byName:             make(map[string]*Definition, len(definitions)),
+		maxUAVObjectLength: definitions.MaxUAVObjectLength(),
+	}
+
+	for _, definition := range definitions {
+		if other, exists := r.byID[definition.ObjectID]; exists {
+			return nil, fmt.Errorf("%s and %s have the same object ID: %d", other.Name, definition.Name, definition.ObjectID)
+		}
+		r.byID[definition.ObjectID] = definition
+
+		name := strings.ToLower(definition.Name)
+		if other, exists := r.byName[name]; exists {
+			return nil, fmt.Errorf("%s and %s have the same name", other.Name, definition.Name)
+		}
+		r.byName[name] = definition
+	}
+	return r, nil
+}
+
+// LoadRegistry loads all the xml files of a directory
+func LoadRegistry(dir string) (*Registry, error) {
+	files, err := ReadDefinitionFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewRegistryFromFiles(files)
+}
+
+// NewRegistryFromFiles creates the definitions of xml files
+func NewRegistryFromFiles(files DefinitionFiles) (*Registry, error) {
+	definitions, err := newDefinitions(files)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRegistry(definitions)
+	if err != nil {
+		return nil, err
+	}
+	r.uavoHash = HashDefinitionFiles(files)
+	return r, nil
+}
+
+// Definitions returns all the definitions, meta definitions included, it must not be modified
+func (r *Registry) Definitions() Definitions {
+	return r.definitions
+}
+
+// Len returns the number of definitions, meta definitions included
+func (r *Registry) Len() int {
+	return len(r.definitions)
+}
+
+// GetDefinitionForObjectID _
+func (r *Registry) GetDefinitionForObjectID(objectID uint32) (*Definition, error) {
+	definition, ok := r.byID[objectID]
+	if ok == false {
+		return nil, errors.New(fmt.Sprint(objectID, " Not found"))
+	}
+	return definition, nil
+}
+
+// GetDefinitionForName finds a definition by name, case insensitive
+func (r *Registry) GetDefinitionForName(name string) (*Definition, error) {
+	definition, ok := r.byName[strings.ToLower(name)]
+	if ok == false {
+		return nil, errors.New(fmt.Sprint(name, " Not found"))
+	}
+	return definition, nil
+}
+
+// UAVOHash returns the hash of the files the definitions were loaded from, zero if they were not loaded from files
+func (r *Registry) UAVOHash() UAVOHash {
+	return r.uavoHash
+}
+
+// MaxUAVObjectLength returns the length of the biggest packet, header included
+func (r *Registry) MaxUAVObjectLength() int {
+	return r.maxUAVObjectLength
+}
@@ -0,0 +1,238 @@
+package uavtalk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * Replay link, feeds a recorded byte stream back to the reader, for regression testing and post-flight analysis.
+ * Supported formats:
+ *	- raw: bytes as received from the flight controller, replayed as fast as possible
+ *	- opl: Tau Labs/OpenPilot GCS logs, each record is a uint32 timestamp (ms), an int64 size and the data
+ *	- capture: files written by the capture layer (see capture.go), only what was received from the controller is replayed
+ * Writes are discarded.
+ */
+
+const replayReadTimeout = 50 * time.Millisecond
+const rawReplayChunkSize = MaxHIDFrameSize
+
+// ReplayConfig holds the settings of a replay link
+type ReplayConfig struct {
+	Path   string
+	Format string  // "raw", "opl" or "capture", guessed from the file when empty
+	Speed  float64 // 1 replays with the original timing, 2 twice as fast, 0 as fast as possible
+	Loop   bool    // start over at the end of the file, otherwise the link stays silent
+}
+
+type replayLink struct {
+	config ReplayConfig
+
+	file   *os.File
+	reader *bufio.Reader
+
+	started        time.Time
+	firstTimestamp time.Duration
+	hasFirst       bool
+	pending        []byte
+	ended          bool
+
+	// wall clock times of the first and current capture headers
+	captureFirst   int64
+	captureSegment int64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ Linker = (*replayLink)(nil)
+
+// NewReplayLink opens the log file
+func NewReplayLink(config ReplayConfig) (Linker, error) {
+	switch config.Format {
+	case "", "raw", "opl", "capture":
+	default:
+		return nil, fmt.Errorf("Unsupported replay format: %s", config.Format)
+	}
+	if config.Speed < 0 {
+		return nil, fmt.Errorf("Invalid replay speed: %f", config.Speed)
+	}
+
+	file, err := os.Open(config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &replayLink{config: config, file: file, closed: make(chan struct{})}
+	l.rewind()
+
+	if len(l.config.Format) == 0 {
+		l.config.Format = "raw"
+		if magic, err := l.reader.Peek(len(captureMagic)); err == nil && string(magic) == captureMagic {
+			l.config.Format = "capture"
+		} else if strings.ToLower(filepath.Ext(config.Path)) == ".opl" {
+			l.config.Format = "opl"
+		}
+	}
+	return l, nil
+}
+
+func (l *replayLink) rewind() {
+	l.reader = bufio.NewReader(l.file)
+	l.started = time.Now()
+	l.hasFirst = false
+	l.ended = false
+	l.captureFirst = 0
+}
+
+// readRecord returns the next chunk of data, and its timestamp relative to the beginning of the file
+func (l *replayLink) readRecord() ([]byte, time.Duration, error) {
+	switch l.config.Format {
+	case "raw":
+		data := make([]byte, rawReplayChunkSize)
+		n, err := l.reader.Read(data)
+		return data[:n], 0, err
+	case "capture":
+		return l.readCaptureRecord()
+	}
+
+	var timestamp uint32
+	var size int64
+	if err := binary.Read(l.reader, binary.LittleEndian, &timestamp); err != nil {
+		return nil, 0, err
+	}
+	if err := binary.Read(l.reader, binary.LittleEndian, &size); err != nil {
+		return nil, 0, err
+	}
+	if size < 0 || size > 1<<20 {
+		return nil, 0, fmt.Errorf("Corrupted opl record, size: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(l.reader, data); err != nil {
+		return nil, 0, err
+	}
+	return data, time.Duration(timestamp) * time.Millisecond, nil
+}
+
+// readCaptureRecord skips the records written to the controller, timestamps are relative to the first capture header
+func (l *replayLink) readCaptureRecord() ([]byte, time.Duration, error) {
+	for {
+		// a capture file can hold several captures, each one starting with a header
+		if magic, err := l.reader.Peek(len(captureMagic)); err == nil && string(magic) == captureMagic {
+			l.reader.Discard(len(captureMagic))
+			if err := binary.Read(l.reader, binary.LittleEndian, &l.captureSegment); err != nil {
+				return nil, 0, err
+			}
+			if l.captureFirst == 0 {
+				l.captureFirst = l.captureSegment
+			}
+			continue
+		}
+
+		header := make([]byte, 13)
+		if _, err := io.ReadFull(l.reader, header); err != nil {
+			return nil, 0, err
+		}
+		offset := int64(binary.LittleEndian.Uint64(header[0:8]))
+		direction := header[8]
+		size := binary.LittleEndian.Uint32(header[9:13])
+		if size > 1<<20 {
+			return nil, 0, fmt.Errorf("Corrupted capture record, size: %d", size)
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(l.reader, data); err != nil {
+			return nil, 0, err
+		}
+		if direction != CaptureRx {
+			continue
+		}
+		return data, time.Duration(l.captureSegment - l.captureFirst + offset), nil
+	}
+}
+
+// wait sleeps until the record is due, returns false if the link got closed in the meantime
+func (l *replayLink) wait(timestamp time.Duration) bool {
+	if l.config.Speed == 0 || l.config.Format == "raw" {
+		return true
+	}
+
+	if l.hasFirst == false {
+		l.firstTimestamp = timestamp
+		l.hasFirst = true
+	}
+
+	due := l.started.Add(time.Duration(float64(timestamp-l.firstTimestamp) / l.config.Speed))
+	delay := due.Sub(time.Now())
+	if delay <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-l.closed:
+		return false
+	}
+}
+
+func (l *replayLink) Read(b []byte) (int, error) {
+	for len(l.pending) == 0 {
+		select {
+		case <-l.closed:
+			return 0, errLinkClosed
+		default:
+		}
+
+		if l.ended {
+			time.Sleep(replayReadTimeout)
+			return 0, nil
+		}
+
+		data, timestamp, err := l.readRecord()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if l.config.Loop == false {
+				log.Infof("Replay of %s done", l.config.Path)
+				l.ended = true
+				continue
+			}
+			if _, err := l.file.Seek(0, 0); err != nil {
+				return 0, err
+			}
+			l.rewind()
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if l.wait(timestamp) == false {
+			return 0, errLinkClosed
+		}
+		l.pending = data
+	}
+
+	n := copy(b, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+func (l *replayLink) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (l *replayLink) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.file.Close()
+}
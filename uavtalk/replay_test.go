@@ -0,0 +1,196 @@
+package uavtalk
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readReplay reads the link until size bytes are read, or it stays silent for a while
+func readReplay(t *testing.T, link Linker, size int) []byte {
+	var result []byte
+	buffer := make([]byte, 4)
+	for silent := 0; len(result) < size && silent < 3; {
+		n, err := link.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			silent++
+		}
+		result = append(result, buffer[:n]...)
+	}
+	return result
+}
+
+func TestReplayFormats(t *testing.T) {
+	tests := []struct {
+		path     string
+		format   string
+		expected string
+		data     []byte
+	}{
+		{"flight.raw", "", "raw", []byte(" !\"#$%&'()*+,-./0123456789:;<=>?")},
+		{"flight.opl", "", "opl", []byte("abcdef")},
+		{"flight.capture", "", "capture", []byte("abcdef")},
+		{"flight.opl", "raw", "raw", nil},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join("testdata/replay", test.path)
+		link, err := NewReplayLink(ReplayConfig{Path: path, Format: test.format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format := link.(*replayLink).config.Format; format != test.expected {
+			t.Errorf("%s: format %s, expected %s", test.path, format, test.expected)
+		}
+
+		expected := test.data
+		if expected == nil {
+			if expected, err = ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		link.(*replayLink).config.Speed = 0
+		if data := readReplay(t, link, len(expected)+1); bytes.Equal(data, expected) == false {
+			t.Errorf("%s as %s: replayed %q, expected %q", test.path, test.expected, data, expected)
+		}
+		link.Close()
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	for _, test := range []struct {
+		config ReplayConfig
+		err    string
+	}{
+		{ReplayConfig{Path: "testdata/replay/flight.opl", Format: "csv"}, "Unsupported replay format: csv"},
+		{ReplayConfig{Path: "testdata/replay/flight.opl", Speed: -1}, "Invalid replay speed"},
+		{ReplayConfig{Path: "testdata/replay/missing.opl"}, "no such file or directory"},
+	} {
+		if link, err := NewReplayLink(test.config); err == nil {
+			link.Close()
+			t.Errorf("%+v: replayed, expected %q", test.config, test.err)
+		} else if strings.Contains(err.Error(), test.err) == false {
+			t.Errorf("%+v: %s, expected %q", test.config, err, test.err)
+		}
+	}
+
+	// the records before the corrupted one are replayed
+	for _, test := range []struct {
+		path string
+		err  string
+	}{
+		{"testdata/replay/corrupted.opl", "Corrupted opl record, size: -1"},
+		{"testdata/replay/corrupted.capture", "Corrupted capture record, size: 2097152"},
+	} {
+		link, err := NewReplayLink(ReplayConfig{Path: test.path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 16)
+		if n, err := link.Read(buffer); err != nil || string(buffer[:n]) != "abc" {
+			t.Errorf("%s: read %q, %v, expected \"abc\"", test.path, buffer[:n], err)
+		}
+		if _, err := link.Read(buffer); err == nil || err.Error() != test.err {
+			t.Errorf("%s: %v, expected %q", test.path, err, test.err)
+		}
+		link.Close()
+	}
+}
+
+// the records of flight.opl are 300ms apart, those of flight.capture 150ms apart
+func TestReplaySpeed(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		speed    float64
+		min, max time.Duration
+	}{
+		{"flight.opl", 1, 300 * time.Millisecond, time.Second},
+		{"flight.opl", 2, 150 * time.Millisecond, 300 * time.Millisecond},
+		{"flight.opl", 0, 0, 100 * time.Millisecond},
+		{"flight.capture", 1, 150 * time.Millisecond, time.Second},
+		{"flight.capture", 0.5, 300 * time.Millisecond, time.Second},
+	} {
+		link, err := NewReplayLink(ReplayConfig{Path: filepath.Join("testdata/replay", test.path), Speed: test.speed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if data := readReplay(t, link, 6); string(data) != "abcdef" {
+			t.Errorf("%s: replayed %q", test.path, data)
+		}
+		if elapsed := time.Since(start); elapsed < test.min || elapsed > test.max {
+			t.Errorf("%s at speed %g: replayed in %s, expected between %s and %s", test.path, test.speed, elapsed, test.min, test.max)
+		}
+		link.Close()
+	}
+}
+
+func TestReplayLoop(t *testing.T) {
+	for _, loop := range []bool{false, true} {
+		link, err := NewReplayLink(ReplayConfig{Path: "testdata/replay/flight.opl", Loop: loop})
+		if err != nil {
+			t.Fatal(err)
+		}
+		link.(*replayLink).config.Speed = 0
+
+		expected := "abcdef"
+		if loop {
+			expected = "abcdefabcdefabcdef"
+		}
+		if data := readReplay(t, link, 18); string(data) != expected {
+			t.Errorf("loop %t: replayed %q, expected %q", loop, data, expected)
+		}
+		link.Close()
+	}
+}
+
+// bufferLink is read from a buffer, what is written to it is kept
+type bufferLink struct {
+	reads   *bytes.Buffer
+	written bytes.Buffer
+}
+
+func (l *bufferLink) Read(b []byte) (int, error)  { return l.reads.Read(b) }
+func (l *bufferLink) Write(b []byte) (int, error) { return l.written.Write(b) }
+func (l *bufferLink) Close() error                { return nil }
+
+// what is read from a captured link is replayed, what is written to it is not
+func TestCaptureReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "uavtalk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flight.capture")
+
+	received := []byte("received from the controller")
+	link, err := NewCaptureLink(&bufferLink{reads: bytes.NewBuffer(received)}, CaptureConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link.Write([]byte("sent"))
+	for {
+		buffer := make([]byte, 5)
+		if _, err := link.Read(buffer); err == io.EOF {
+			break
+		}
+	}
+	link.Close()
+
+	replay, err := NewReplayLink(ReplayConfig{Path: path, Speed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	if data := readReplay(t, replay, len(received)+1); bytes.Equal(data, received) == false {
+		t.Errorf("replayed %q, expected %q", data, received)
+	}
+}
@@ -0,0 +1,61 @@
+package uavtalk
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Serial (UART) link, used by telemetry radios or when the flight controller main port
+ * is directly wired to the computer running the bridge.
+ * Anything behaving like a tty works, including pseudo-terminals.
+ */
+
+const defaultSerialBaud = 57600
+
+// serialReadTimeout is expressed in tenths of seconds (termios VTIME), a Read returns 0 bytes when it expires, like usbLink
+const serialReadTimeout = 1
+
+// SerialConfig holds the settings of a serial link
+type SerialConfig struct {
+	Device   string // eg. /dev/ttyUSB0 or /dev/ttyAMA0
+	Baud     int    // defaults to 57600
+	Parity   string // "none" (default), "odd" or "even"
+	StopBits int    // 1 (default) or 2
+}
+
+func (config *SerialConfig) setup() error {
+	if len(config.Device) == 0 {
+		return fmt.Errorf("No serial device specified")
+	}
+
+	if config.Baud == 0 {
+		config.Baud = defaultSerialBaud
+	}
+
+	config.Parity = strings.ToLower(config.Parity)
+	switch config.Parity {
+	case "":
+		config.Parity = "none"
+	case "none", "odd", "even":
+	default:
+		return fmt.Errorf("Unsupported parity: %s", config.Parity)
+	}
+
+	switch config.StopBits {
+	case 0:
+		config.StopBits = 1
+	case 1, 2:
+	default:
+		return fmt.Errorf("Unsupported stop bits: %d", config.StopBits)
+	}
+	return nil
+}
+
+// NewSerialLink opens and configures (8 data bits, raw mode, no flow control) the serial device
+func NewSerialLink(config SerialConfig) (Linker, error) {
+	if err := config.setup(); err != nil {
+		return nil, err
+	}
+	return openSerialLink(config)
+}
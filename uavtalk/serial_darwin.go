@@ -0,0 +1,38 @@
+package uavtalk
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const ioctlGetAttr = syscall.TIOCGETA
+const ioctlSetAttr = syscall.TIOCSETA
+
+// CCTS_OFLOW | CRTS_IFLOW, not exported by the syscall package
+const crtscts = 0x30000
+
+// speeds are plain values on darwin
+var baudRates = map[int]uint64{
+	9600:   9600,
+	19200:  19200,
+	38400:  38400,
+	57600:  57600,
+	115200: 115200,
+	230400: 230400,
+	460800: 460800,
+	921600: 921600,
+}
+
+func setSpeed(t *syscall.Termios, speed uint64) {
+	t.Ispeed = speed
+	t.Ospeed = speed
+}
+
+// poll checks fds without waiting
+func poll(fds []pollFd) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_POLL, uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
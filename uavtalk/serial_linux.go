@@ -0,0 +1,41 @@
+package uavtalk
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const ioctlGetAttr = syscall.TCGETS
+const ioctlSetAttr = syscall.TCSETS
+
+// not exported by the syscall package
+const cbaud = 0x100f
+const crtscts = 0x80000000
+
+var baudRates = map[int]uint64{
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+	460800: syscall.B460800,
+	921600: syscall.B921600,
+}
+
+func setSpeed(t *syscall.Termios, speed uint64) {
+	t.Cflag &^= cbaud
+	t.Cflag |= uint32(speed)
+	t.Ispeed = uint32(speed)
+	t.Ospeed = uint32(speed)
+}
+
+// poll checks fds without waiting, ppoll is the one poll call available on every linux architecture
+func poll(fds []pollFd) error {
+	var timeout syscall.Timespec
+	_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), uintptr(unsafe.Pointer(&timeout)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
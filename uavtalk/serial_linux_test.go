@@ -0,0 +1,110 @@
+package uavtalk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty opens a pseudo-terminal pair, the slave is the device the serial link opens
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %s", err)
+	}
+
+	var unlock int32
+	if err := ioctl(int(master.Fd()), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	var n uint32
+	if err := ioctl(int(master.Fd()), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// readFull reads from the link until len(b) bytes are read, or the deadline
+func readFull(link Linker, b []byte, deadline time.Time) error {
+	for read := 0; read < len(b); {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d bytes read out of %d", read, len(b))
+		}
+		n, err := link.Read(b[read:])
+		if err != nil {
+			return err
+		}
+		read += n
+	}
+	return nil
+}
+
+func TestSerialLinkPty(t *testing.T) {
+	master, device := openPty(t)
+	defer master.Close()
+
+	link, err := NewSerialLink(SerialConfig{Device: device, Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	frame := []byte{0x3c, 0x20, 0x0a, 0x00, 0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0xff}
+
+	// flight controller -> bridge
+	if _, err := master.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	received := make([]byte, len(frame))
+	if err := readFull(link, received, time.Now().Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(received, frame) == false {
+		t.Fatalf("link read % x, expected % x", received, frame)
+	}
+
+	// bridge -> flight controller
+	if n, err := link.Write(frame); err != nil || n != len(frame) {
+		t.Fatalf("link write: %d, %v", n, err)
+	}
+	received = make([]byte, len(frame))
+	if _, err := master.Read(received); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(received, frame) == false {
+		t.Fatalf("master read % x, expected % x", received, frame)
+	}
+
+	// nothing to read, the read times out without error
+	if n, err := link.Read(received); n != 0 || err != nil {
+		t.Fatalf("idle read: %d, %v", n, err)
+	}
+}
+
+func TestSerialLinkHangUp(t *testing.T) {
+	master, device := openPty(t)
+
+	link, err := NewSerialLink(SerialConfig{Device: device})
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	defer link.Close()
+
+	master.Close()
+
+	buffer := make([]byte, 16)
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := link.Read(buffer); err != nil {
+			return
+		}
+	}
+	t.Fatal("the hang up was not reported")
+}
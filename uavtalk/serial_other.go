@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package uavtalk
+
+import "errors"
+
+func openSerialLink(config SerialConfig) (Linker, error) {
+	return nil, errors.New("Serial links are not supported on this platform")
+}
@@ -0,0 +1,141 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package uavtalk
+
+import (
+	"fmt"
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+type serialLink struct {
+	fd int
+}
+
+var _ Linker = (*serialLink)(nil)
+
+func openSerialLink(config SerialConfig) (Linker, error) {
+	speed, ok := baudRates[config.Baud]
+	if ok == false {
+		return nil, fmt.Errorf("Unsupported baud rate: %d", config.Baud)
+	}
+
+	fd, err := syscall.Open(config.Device, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", config.Device, err)
+	}
+
+	if err := configureSerial(fd, speed, config); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("%s: %s", config.Device, err)
+	}
+
+	// O_NONBLOCK was only there to avoid waiting for carrier detect on open,
+	// reads are then bounded by VTIME.
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &serialLink{fd}, nil
+}
+
+func configureSerial(fd int, speed uint64, config SerialConfig) error {
+	var t syscall.Termios
+	if err := ioctl(fd, ioctlGetAttr, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+
+	// raw mode, see cfmakeraw(3)
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON | syscall.IXOFF | syscall.IXANY
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.PARODD | syscall.CSTOPB | crtscts
+	t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+
+	switch config.Parity {
+	case "odd":
+		t.Cflag |= syscall.PARENB | syscall.PARODD
+		t.Iflag |= syscall.INPCK
+	case "even":
+		t.Cflag |= syscall.PARENB
+		t.Iflag |= syscall.INPCK
+	}
+
+	if config.StopBits == 2 {
+		t.Cflag |= syscall.CSTOPB
+	}
+
+	t.Cc[syscall.VMIN] = 0
+	t.Cc[syscall.VTIME] = serialReadTimeout
+
+	setSpeed(&t, speed)
+
+	return ioctl(fd, ioctlSetAttr, uintptr(unsafe.Pointer(&t)))
+}
+
+func ioctl(fd int, request uintptr, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// pollfd events, the same on linux and darwin
+const (
+	pollErr   = 0x8
+	pollHup   = 0x10
+	pollNoVal = 0x20
+)
+
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// Read returns 0 bytes when the read timeout expires, and io.EOF once the device is gone
+func (l *serialLink) Read(b []byte) (int, error) {
+	n, err := syscall.Read(l.fd, b)
+	if err == syscall.EINTR || err == syscall.EAGAIN {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// a hang up or an unplug reads as a timeout, only poll tells them apart
+	if n == 0 && l.hungUp() {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (l *serialLink) hungUp() bool {
+	fds := []pollFd{{fd: int32(l.fd)}}
+	if err := poll(fds); err != nil {
+		return false
+	}
+	return fds[0].revents&(pollErr|pollHup|pollNoVal) != 0
+}
+
+func (l *serialLink) Write(b []byte) (int, error) {
+	currentOffset := 0
+	for currentOffset < len(b) {
+		n, err := syscall.Write(l.fd, b[currentOffset:])
+		if err == syscall.EINTR || err == syscall.EAGAIN {
+			continue
+		}
+		if err != nil {
+			return currentOffset, err
+		}
+		currentOffset += n
+	}
+	return currentOffset, nil
+}
+
+func (l *serialLink) Close() error {
+	return syscall.Close(l.fd)
+}
@@ -1,29 +1,27 @@
 package uavtalk
 
-import log "github.com/Sirupsen/logrus"
-
-func CreateObjectRequest(name string, index int) *Packet {
-	definition, err := AllDefinitions.GetDefinitionForName(name)
+func (r *Registry) CreateObjectRequest(name string, index int) (*Packet, error) {
+	definition, err := r.GetDefinitionForName(name)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	packet := NewPacket(definition, ObjectRequest, uint16(index), map[string]interface{}{})
-	return packet
+	return packet, nil
 }
 
-func CreateObjectSetter(name string, index int, data map[string]interface{}) *Packet {
-	definition, err := AllDefinitions.GetDefinitionForName(name)
+func (r *Registry) CreateObjectSetter(name string, index int, data map[string]interface{}) (*Packet, error) {
+	definition, err := r.GetDefinitionForName(name)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	packet := NewPacket(definition, ObjectCmd, uint16(index), data)
-	return packet
+	return packet, nil
 }
 
-func CreateGCSTelemetryStatsObjectPacket(status string) Packet {
-	definition, err := AllDefinitions.GetDefinitionForName("GCSTelemetryStats")
+func (r *Registry) CreateGCSTelemetryStatsObjectPacket(status string) (Packet, error) {
+	definition, err := r.GetDefinitionForName("GCSTelemetryStats")
 	if err != nil {
-		log.Fatal(err)
+		return Packet{}, err
 	}
 	packet := NewPacket(definition, ObjectCmd, 0, map[string]interface{}{
 		"Status":     status,
@@ -33,22 +31,22 @@ func CreateGCSTelemetryStatsObjectPacket(status string) Packet {
 		"RxFailures": float64(0),
 		"TxRetries":  float64(0),
 	})
-	return *packet
+	return *packet, nil
 }
 
-func CreateSessionManagingRequest() Packet {
-	definition, err := AllDefinitions.GetDefinitionForName("SessionManaging")
+func (r *Registry) CreateSessionManagingRequest() (Packet, error) {
+	definition, err := r.GetDefinitionForName("SessionManaging")
 	if err != nil {
-		log.Fatal(err)
+		return Packet{}, err
 	}
 	packet := NewPacket(definition, ObjectRequest, 0, map[string]interface{}{})
-	return *packet
+	return *packet, nil
 }
 
-func CreateSessionManagingPacket(sessionID uint16, objectOfInterestIndex uint8) Packet {
-	definition, err := AllDefinitions.GetDefinitionForName("SessionManaging")
+func (r *Registry) CreateSessionManagingPacket(sessionID uint16, objectOfInterestIndex uint8) (Packet, error) {
+	definition, err := r.GetDefinitionForName("SessionManaging")
 	if err != nil {
-		log.Fatal(err)
+		return Packet{}, err
 	}
 	packet := NewPacket(definition, ObjectCmd, 0, map[string]interface{}{
 		"SessionID":             float64(sessionID),
@@ -57,21 +55,22 @@ func CreateSessionManagingPacket(sessionID uint16, objectOfInterestIndex uint8)
 		"NumberOfObjects":       float64(0),
 		"ObjectOfInterestIndex": float64(objectOfInterestIndex),
 	})
-	return *packet
+	return *packet, nil
 }
 
-func CreatePersistObject(definition *Definition, instanceID uint16) Packet {
-	objectPersistenceDefinition, err := AllDefinitions.GetDefinitionForName("ObjectPersistence")
+func (r *Registry) CreatePersistObject(definition *Definition, instanceID uint16) (Packet, error) {
+	objectPersistenceDefinition, err := r.GetDefinitionForName("ObjectPersistence")
 	if err != nil {
-		log.Fatal(err)
+		return Packet{}, err
 	}
-	packet := NewPacket(objectPersistenceDefinition, ObjectCmdWithAck, instanceID, map[string]interface{}{
+	// ObjectPersistence is single instance, the instance saved is given by its InstanceID field
+	packet := NewPacket(objectPersistenceDefinition, ObjectCmdWithAck, 0, map[string]interface{}{
 		"ObjectID":   float64(definition.ObjectID),
 		"InstanceID": float64(instanceID),
 		"Selection":  "SingleObject",
 		"Operation":  "Save",
 	})
-	return *packet
+	return *packet, nil
 }
 
 func CreatePacketAck(definition *Definition) Packet {
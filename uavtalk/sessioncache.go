@@ -0,0 +1,110 @@
+package uavtalk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * SessionCache keeps the objects of the sessions enumerated on disk, so a session still open on the flight
+ * controller is recovered without enumerating its objects again, after a restart of the bridge or a replug.
+ * Sessions are keyed by firmware identity, link and session ID, one file each: <uavo hash>-<link>-<session id>.json,
+ * where link is a hash of the link URI, so vehicles sharing the cache do not replace each other's sessions.
+ * Only the last session of each firmware is kept for each link.
+ * The firmware identity is the UAVO hash reported by the firmware, or the one of the definitions in use
+ * when the firmware was not identified.
+ */
+
+// SessionCache is a directory of sessions
+type SessionCache struct {
+	dir string
+}
+
+type cachedSession struct {
+	SessionID uint16         `json:"sessionID"`
+	UAVOHash  string         `json:"uavoHash"`
+	LinkURI   string         `json:"linkURI"`
+	Objects   []cachedObject `json:"objects"`
+}
+
+type cachedObject struct {
+	ObjectID  uint32 `json:"id"`
+	Name      string `json:"name"`
+	Instances int    `json:"instances"`
+}
+
+// NewSessionCache creates a session cache, the directory is created on the first save
+func NewSessionCache(dir string) *SessionCache {
+	return &SessionCache{dir}
+}
+
+// prefix returns the start of the file names of the sessions of a firmware on a link
+func (c *SessionCache) prefix(hash UAVOHash, linkURI string) string {
+	link := sha1.Sum([]byte(linkURI))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s-", hash, hex.EncodeToString(link[:4])))
+}
+
+func (c *SessionCache) path(hash UAVOHash, linkURI string, sessionID uint16) string {
+	return fmt.Sprintf("%s%d.json", c.prefix(hash, linkURI), sessionID)
+}
+
+// Load returns the objects of a session enumerated on a link, resolved with registry, false if the session is unknown
+// or does not match the definitions
+func (c *SessionCache) Load(hash UAVOHash, linkURI string, sessionID uint16, registry *Registry) ([]ActiveObject, bool) {
+	data, err := ioutil.ReadFile(c.path(hash, linkURI, sessionID))
+	if err != nil {
+		return nil, false
+	}
+
+	var session cachedSession
+	if err := json.Unmarshal(data, &session); err != nil || session.LinkURI != linkURI {
+		return nil, false
+	}
+
+	objects := make([]ActiveObject, 0, len(session.Objects))
+	for _, object := range session.Objects {
+		definition, err := registry.GetDefinitionForObjectID(object.ObjectID)
+		if err != nil || definition.Name != object.Name {
+			return nil, false
+		}
+		objects = append(objects, ActiveObject{definition, object.Instances})
+	}
+	return objects, true
+}
+
+// Save stores the objects of a session enumerated on a link, replacing the previous session of the firmware on that link
+func (c *SessionCache) Save(hash UAVOHash, linkURI string, sessionID uint16, objects []ActiveObject) error {
+	session := cachedSession{SessionID: sessionID, UAVOHash: hash.String(), LinkURI: linkURI}
+	for _, object := range objects {
+		session.Objects = append(session.Objects, cachedObject{object.Definition.ObjectID, object.Definition.Name, object.Instances})
+	}
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	path := c.path(hash, linkURI, sessionID)
+	// written aside then renamed, a session is never read half written
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	previous, _ := filepath.Glob(c.prefix(hash, linkURI) + "*.json")
+	for _, file := range previous {
+		if file != path {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
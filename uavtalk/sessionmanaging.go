@@ -0,0 +1,304 @@
+package uavtalk
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * Session enumerates the objects instantiated by the firmware, with SessionManaging:
+ *	the current SessionManaging is requested, if its SessionID is the one of the last session enumerated,
+ *	or of a session of the Cache for this firmware, and the number of objects did not change,
+ *	the objects of that session are reported right away.
+ *	Otherwise a new SessionID is set, and ObjectOfInterestIndex is set from 0 to NumberOfObjects - 1,
+ *	the flight controller answers each with the ObjectID and ObjectInstances of the object at that index.
+ *	The session is then finished by setting ObjectOfInterestIndex to 0xFF, so the flight controller
+ *	does not wait for more requests.
+ * Each request is sent again when it is not answered in time, answers to other requests are ignored.
+ *
+ * Session does not read the connection, link states and SessionManaging packets have to be given to it,
+ * eg. by the handlers reading the connection. Giving them never blocks: when the session lags behind,
+ * SessionManaging packets are dropped, and sent again as they are not answered, only the last link state is kept.
+ */
+
+const sessionEndIndex = 0xFF
+const sessionRetryTimeout = 1 * time.Second
+const sessionRetries = 5
+
+// ActiveObject is an object instantiated by the firmware
+type ActiveObject struct {
+	Definition *Definition
+	Instances  int
+}
+
+type sessionState int
+
+const (
+	sessionIdle sessionState = iota
+	sessionRequesting
+	sessionEnumerating
+)
+
+// Session enumerates the objects of the flight controller
+type Session struct {
+	Cache *SessionCache // sessions enumerated before, nil to only recover the last session of this Session
+
+	connection *Connection
+	packets    chan Packet
+	begins     chan struct{}
+	linkStates chan LinkState
+
+	mutex     sync.Mutex
+	callbacks []func(sessionID uint16, objects []ActiveObject)
+
+	// owned by the Start goroutine
+	state           sessionState
+	registry        *Registry
+	sessionID       uint16
+	index           int
+	numberOfObjects int
+	objects         []ActiveObject
+	pending         *Packet
+	retries         int
+	deadline        time.Time
+
+	// the last session enumerated
+	lastIdentity  UAVOHash
+	lastSessionID uint16
+	lastObjects   []ActiveObject
+}
+
+// NewSession creates the session client of a connection, nothing happens until Start is called
+func NewSession(connection *Connection) *Session {
+	return &Session{
+		connection: connection,
+		packets:    make(chan Packet, 10),
+		begins:     make(chan struct{}, 1),
+		linkStates: make(chan LinkState, 1),
+	}
+}
+
+// OnComplete registers a callback, called from the session goroutine with the objects of the flight controller,
+// each time an enumeration completes, it must not block
+func (s *Session) OnComplete(callback func(sessionID uint16, objects []ActiveObject)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.callbacks = append(s.callbacks, callback)
+}
+
+// Begin starts an enumeration, eg. once the telemetry is connected, an enumeration in progress starts over
+func (s *Session) Begin() {
+	select {
+	case s.begins <- struct{}{}:
+	default:
+	}
+}
+
+// HandlePacket takes the packets received from the flight controller, only SessionManaging is used
+func (s *Session) HandlePacket(packet Packet) {
+	if packet.Definition.Name != "SessionManaging" {
+		return
+	}
+	select {
+	case s.packets <- packet:
+	default:
+		log.Warningf("%s: SessionManaging dropped, the session does not keep up", s.connection.LinkURI)
+	}
+}
+
+// HandleLinkState takes the link state changes of the connection, a state not handled yet is replaced
+func (s *Session) HandleLinkState(state LinkState) {
+	for {
+		select {
+		case s.linkStates <- state:
+			return
+		default:
+		}
+		select {
+		case <-s.linkStates:
+		default:
+		}
+	}
+}
+
+// Start runs the session client, it never returns
+func (s *Session) Start() {
+	for {
+		var timeout <-chan time.Time
+		if s.state != sessionIdle {
+			timeout = time.After(s.deadline.Sub(time.Now()))
+		}
+
+		select {
+		case <-s.begins:
+			s.begin()
+		case state := <-s.linkStates:
+			if state == LinkDown && s.state != sessionIdle {
+				log.Warningf("%s: link down, session aborted", s.connection.LinkURI)
+				s.state = sessionIdle
+			}
+		case packet := <-s.packets:
+			s.handle(packet)
+		case <-timeout:
+			s.retry()
+		}
+	}
+}
+
+func (s *Session) begin() {
+	s.registry = s.connection.Registry()
+	s.state = sessionRequesting
+	s.objects = nil
+
+	definition, err := s.registry.GetDefinitionForName("SessionManaging")
+	if err != nil {
+		log.Warning(err)
+		s.state = sessionIdle
+		return
+	}
+	s.request(NewPacket(definition, ObjectRequest, 0, map[string]interface{}{}))
+}
+
+func (s *Session) handle(packet Packet) {
+	if packet.Cmd == ObjectCmdWithAck {
+		s.send(CreatePacketAck(packet.Definition))
+	}
+	if packet.Cmd != ObjectCmd && packet.Cmd != ObjectCmdWithAck {
+		return
+	}
+
+	sessionID, _ := packet.Data["SessionID"].(uint16)
+	objectID, _ := packet.Data["ObjectID"].(uint32)
+	instances, _ := packet.Data["ObjectInstances"].(uint8)
+	numberOfObjects, _ := packet.Data["NumberOfObjects"].(uint8)
+	index, _ := packet.Data["ObjectOfInterestIndex"].(uint8)
+
+	switch s.state {
+	case sessionRequesting:
+		if objects, ok := s.recover(sessionID); ok && int(numberOfObjects) == len(objects) {
+			log.Infof("%s: session %d recovered", s.connection.LinkURI, sessionID)
+			s.lastIdentity, s.lastSessionID, s.lastObjects = s.firmwareIdentity(), sessionID, objects
+			s.complete(sessionID, objects)
+			return
+		}
+		s.sessionID = newSessionID(s.lastSessionID)
+		s.numberOfObjects = int(numberOfObjects)
+		s.index = 0
+		s.state = sessionEnumerating
+		log.Infof("%s: session %d, %d objects", s.connection.LinkURI, s.sessionID, s.numberOfObjects)
+		s.next()
+	case sessionEnumerating:
+		if sessionID != s.sessionID || int(index) != s.index {
+			// answer to a request sent again
+			return
+		}
+		if definition, err := s.registry.GetDefinitionForObjectID(objectID); err != nil {
+			log.Warningf("%s: session object %d: %s", s.connection.LinkURI, s.index, err)
+		} else {
+			s.objects = append(s.objects, ActiveObject{definition, int(instances)})
+		}
+		s.index++
+		s.next()
+	}
+}
+
+// next asks for the next object, or finishes the session
+func (s *Session) next() {
+	packet, err := s.registry.CreateSessionManagingPacket(s.sessionID, uint8(s.index))
+	if err != nil {
+		log.Warning(err)
+		s.state = sessionIdle
+		return
+	}
+	if s.index < s.numberOfObjects {
+		s.request(&packet)
+		return
+	}
+
+	finish, err := s.registry.CreateSessionManagingPacket(s.sessionID, sessionEndIndex)
+	if err != nil {
+		log.Warning(err)
+	} else {
+		s.send(finish)
+	}
+	s.lastIdentity, s.lastSessionID, s.lastObjects = s.firmwareIdentity(), s.sessionID, s.objects
+	if s.Cache != nil {
+		if err := s.Cache.Save(s.firmwareIdentity(), s.connection.LinkURI, s.sessionID, s.objects); err != nil {
+			log.Warningf("%s: session %d not cached: %s", s.connection.LinkURI, s.sessionID, err)
+		}
+	}
+	s.complete(s.sessionID, s.objects)
+}
+
+// recover returns the objects of a session enumerated before
+func (s *Session) recover(sessionID uint16) ([]ActiveObject, bool) {
+	if sessionID == 0 {
+		return nil, false
+	}
+	if sessionID == s.lastSessionID && s.firmwareIdentity() == s.lastIdentity {
+		return s.lastObjects, true
+	}
+	if s.Cache != nil {
+		return s.Cache.Load(s.firmwareIdentity(), s.connection.LinkURI, sessionID, s.registry)
+	}
+	return nil, false
+}
+
+// firmwareIdentity keys the cached sessions, see SessionCache
+func (s *Session) firmwareIdentity() UAVOHash {
+	if hash := s.connection.FirmwareUAVOHash(); hash.IsZero() == false {
+		return hash
+	}
+	return s.registry.UAVOHash()
+}
+
+// request sends a packet, which is sent again until answered
+func (s *Session) request(packet *Packet) {
+	s.pending = packet
+	s.retries = 0
+	s.deadline = time.Now().Add(sessionRetryTimeout)
+	s.send(*packet)
+}
+
+func (s *Session) retry() {
+	if s.retries >= sessionRetries {
+		log.Warningf("%s: no SessionManaging answer, session aborted", s.connection.LinkURI)
+		s.state = sessionIdle
+		return
+	}
+	s.retries++
+	s.connection.countRetry()
+	s.deadline = time.Now().Add(sessionRetryTimeout)
+	s.send(*s.pending)
+}
+
+func (s *Session) complete(sessionID uint16, objects []ActiveObject) {
+	s.state = sessionIdle
+	log.Infof("%s: session %d, %d active objects", s.connection.LinkURI, sessionID, len(objects))
+
+	s.mutex.Lock()
+	callbacks := s.callbacks
+	s.mutex.Unlock()
+	for _, callback := range callbacks {
+		callback(sessionID, objects)
+	}
+}
+
+func (s *Session) send(packet Packet) {
+	select {
+	case s.connection.InChan <- packet:
+	default:
+		log.Warningf("%s: SessionManaging dropped, the link does not keep up", s.connection.LinkURI)
+	}
+}
+
+// newSessionID returns a session ID, never 0, nor the last one
+func newSessionID(last uint16) uint16 {
+	id := uint16(time.Now().UnixNano() >> 20)
+	for id == 0 || id == last {
+		id++
+	}
+	return id
+}
@@ -0,0 +1,303 @@
+package uavtalk
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * The supervisor owns the link: it opens it, identifies the firmware when the connection has a Library,
+ * runs the reader and writer goroutines, and when one of them fails (eg. the USB cable got unplugged),
+ * it closes the link, waits for the goroutines to stop, and opens the link again.
+ * While the link is down, the packets sent to InChan are dropped: they would reach the controller
+ * after the reconnection, once their transactions were reported as failed.
+ */
+
+// LinkState is sent on each link state change
+type LinkState int
+
+const (
+	LinkDown LinkState = iota
+	LinkUp
+)
+
+func (state LinkState) String() string {
+	if state == LinkUp {
+		return "up"
+	}
+	return "down"
+}
+
+const linkRetryPeriod = 1 * time.Second
+
+const firmwareRequestRetries = 3
+const firmwareRequestTimeout = 1 * time.Second
+
+func openLink(linkURI string, registry *Registry) Linker {
+	for {
+		link, err := NewLink(linkURI, registry)
+		if err == nil {
+			return link
+		}
+		log.Warning(err)
+		time.Sleep(linkRetryPeriod)
+	}
+}
+
+// linkReader reads the link in its own goroutine, so reads can be given up on without losing data
+type linkReader struct {
+	chunks chan []byte
+	err    error // set once chunks is closed
+}
+
+// run runs the link until it fails
+func (c *Connection) run() {
+	stopDropping := make(chan struct{})
+	dropped := make(chan struct{})
+	go func() {
+		defer close(dropped)
+		c.dropUntil(stopDropping)
+	}()
+
+	link := openLink(c.LinkURI, c.defaultRegistry)
+	log.Infof("Link %s up", c.LinkURI)
+
+	done := make(chan struct{})
+	errChan := make(chan error, 2)
+	reader := &linkReader{chunks: make(chan []byte, 16)}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		c.readChunks(link, reader, done)
+	}()
+
+	// what was read while identifying the firmware is parsed with the definitions picked
+	received := c.identify(link, reader)
+	c.Parser.setRegistry(c.Registry())
+	close(stopDropping)
+	<-dropped
+	c.setUp(true)
+	c.StateChan <- LinkUp
+
+	go func() {
+		defer wg.Done()
+		errChan <- c.readLoop(reader, received, done)
+	}()
+	go func() {
+		defer wg.Done()
+		errChan <- c.writeLoop(link, done)
+	}()
+
+	err := <-errChan
+	c.setUp(false)
+	log.Warningf("Link %s down: %s", c.LinkURI, err)
+
+	// closing the link unblocks pending reads and writes
+	close(done)
+	link.Close()
+	wg.Wait()
+
+	// what is still queued is dropped before the transactions hear of it
+	c.countDropped(c.dropQueued())
+	c.StateChan <- LinkDown
+}
+
+// dropUntil drops the packets sent to InChan until stop is closed, then those still queued
+func (c *Connection) dropUntil(stop chan struct{}) {
+	count := 0
+	for {
+		select {
+		case <-c.InChan:
+			count++
+		case <-stop:
+			c.countDropped(count + c.dropQueued())
+			return
+		}
+	}
+}
+
+// dropQueued drops the packets waiting in InChan, returns their count
+func (c *Connection) dropQueued() int {
+	count := 0
+	for {
+		select {
+		case <-c.InChan:
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+func (c *Connection) countDropped(count int) {
+	if count > 0 {
+		atomic.AddUint64(&c.txFailures, uint64(count))
+		log.Infof("%s: %d packets dropped, the link is down", c.LinkURI, count)
+	}
+}
+
+// readChunks reads from the link, until it fails or done is closed
+func (c *Connection) readChunks(link Linker, reader *linkReader, done chan struct{}) {
+	defer close(reader.chunks)
+
+	buffer := make([]byte, MaxHIDFrameSize)
+	for {
+		select {
+		case <-done:
+			reader.err = errLinkClosed
+			return
+		default:
+		}
+
+		n, err := link.Read(buffer)
+		if err != nil {
+			reader.err = err
+			return
+		}
+		if n == 0 {
+			continue
+		}
+
+		chunk := make([]byte, n)
+		copy(chunk, buffer[0:n])
+		select {
+		case reader.chunks <- chunk:
+		case <-done:
+			reader.err = errLinkClosed
+			return
+		}
+	}
+}
+
+// identify picks the definitions matching the firmware from the library, returns what was read in the meantime
+func (c *Connection) identify(link Linker, reader *linkReader) []byte {
+	if c.Library == nil {
+		return nil
+	}
+
+	var received []byte
+	hash, err := c.requestUAVOHash(link, reader, &received)
+	if err != nil {
+		log.Warningf("%s: could not identify the firmware, using the default definitions read-only: %s", c.LinkURI, err)
+		c.setRegistry(c.defaultRegistry, false, UAVOHash{})
+		return received
+	}
+
+	name, registry, ok := c.Library.Match(hash)
+	if ok == false {
+		log.Warningf("%s: no definitions match the firmware UAVO hash %s, using the default definitions read-only", c.LinkURI, hash)
+		c.setRegistry(c.defaultRegistry, false, hash)
+		return received
+	}
+
+	log.Infof("%s: firmware UAVO hash %s, using definitions %s", c.LinkURI, hash, name)
+	c.setRegistry(registry, true, hash)
+	return received
+}
+
+// requestUAVOHash requests FirmwareIAPObj until it is received, received holds all that was read
+func (c *Connection) requestUAVOHash(link Linker, reader *linkReader, received *[]byte) (UAVOHash, error) {
+	registry, definition, ok := c.Library.firmwareIAPObj()
+	if ok == false {
+		return UAVOHash{}, fmt.Errorf("%s is not defined", firmwareIAPObjName)
+	}
+
+	request, err := NewPacket(definition, ObjectRequest, 0, map[string]interface{}{}).toBinary()
+	if err != nil {
+		return UAVOHash{}, err
+	}
+
+	parser := NewParser(registry)
+	for attempt := 0; attempt < firmwareRequestRetries; attempt++ {
+		if _, err := link.Write(request); err != nil {
+			return UAVOHash{}, err
+		}
+
+		timeout := time.After(firmwareRequestTimeout)
+		for waiting := true; waiting; {
+			select {
+			case chunk, ok := <-reader.chunks:
+				if ok == false {
+					return UAVOHash{}, reader.err
+				}
+				*received = append(*received, chunk...)
+
+				packets, _ := parser.Feed(chunk)
+				for _, packet := range packets {
+					if packet.Definition == definition && (packet.Cmd == ObjectCmd || packet.Cmd == ObjectCmdWithAck) {
+						return FirmwareUAVOHash(packet)
+					}
+				}
+			case <-timeout:
+				waiting = false
+			}
+		}
+	}
+	return UAVOHash{}, fmt.Errorf("no answer to %s requests", firmwareIAPObjName)
+}
+
+// readLoop parses what is read from the controller, until the link fails or done is closed
+func (c *Connection) readLoop(reader *linkReader, received []byte, done chan struct{}) error {
+	chunk := received
+	for {
+		atomic.AddUint64(&c.rxBytes, uint64(len(chunk)))
+		packets, errs := c.Parser.Feed(chunk)
+		for _, err := range errs {
+			log.Warning(err)
+			if parseError, ok := err.(*ParseError); ok && parseError.Frame != nil {
+				PrintHex(parseError.Frame, len(parseError.Frame))
+			}
+		}
+		for _, packet := range packets {
+			select {
+			case c.OutChan <- *packet:
+			case <-done:
+				return nil
+			}
+		}
+
+		var ok bool
+		select {
+		case chunk, ok = <-reader.chunks:
+			if ok == false {
+				return reader.err
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// writeLoop writes to controller, until the link fails or done is closed
+func (c *Connection) writeLoop(link Linker, done chan struct{}) error {
+	for {
+		select {
+		case packet := <-c.InChan:
+			binaryPacket, err := packet.toBinary()
+			if err != nil {
+				log.Warning(err)
+				atomic.AddUint64(&c.txFailures, 1)
+				continue
+			}
+
+			if _, err := link.Write(binaryPacket); err != nil {
+				atomic.AddUint64(&c.txFailures, 1)
+				if err == errNoPeer {
+					// the packet is lost, not the link
+					log.Debugf("%s: %s not sent: %s", c.LinkURI, packet.Definition.Name, err)
+					continue
+				}
+				return err
+			}
+			atomic.AddUint64(&c.txBytes, uint64(len(binaryPacket)))
+			atomic.AddUint64(&c.txPackets, 1)
+		case <-done:
+			return nil
+		}
+	}
+}
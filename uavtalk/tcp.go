@@ -0,0 +1,128 @@
+package uavtalk
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * TCP link, either dialing a remote end (FC simulator, ser2net bridges),
+ * or listening for it to connect.
+ * Opening the link makes a single attempt: a dial, or waiting for a peer to connect, within Timeout,
+ * and returns the error otherwise, the link is retried by the supervisor as any other link.
+ * The loss of the connection fails reads and writes, the supervisor then reopens the link,
+ * so a new peer gets a new handshake.
+ */
+
+const defaultTCPAddress = "localhost:9000"
+const defaultTCPKeepAlive = 10 * time.Second
+const defaultTCPTimeout = 5 * time.Second
+
+// TCPConfig holds the settings of a TCP link
+type TCPConfig struct {
+	Address   string        // host:port to dial, or to listen on, defaults to localhost:9000
+	Listen    bool          // accept the connection instead of dialing
+	KeepAlive time.Duration // TCP keepalive period, defaults to 10s
+	Timeout   time.Duration // to dial, or for a peer to connect, defaults to 5s
+}
+
+type tcpLink struct {
+	config TCPConfig
+	conn   *net.TCPConn
+}
+
+var _ Linker = (*tcpLink)(nil)
+
+// NewTCPLink creates a TCP link, it returns once connected, or after Timeout
+func NewTCPLink(config TCPConfig) (Linker, error) {
+	if len(config.Address) == 0 {
+		config.Address = defaultTCPAddress
+	}
+	if config.KeepAlive == 0 {
+		config.KeepAlive = defaultTCPKeepAlive
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTCPTimeout
+	}
+
+	l := &tcpLink{config: config}
+	var err error
+	if config.Listen {
+		l.conn, err = l.accept()
+	} else {
+		l.conn, err = l.dial()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *tcpLink) dial() (*net.TCPConn, error) {
+	conn, err := net.DialTimeout("tcp", l.config.Address, l.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return l.setupConn(conn)
+}
+
+// accept waits for a single peer, the port is not listened on once connected
+func (l *tcpLink) accept() (*net.TCPConn, error) {
+	address, err := net.ResolveTCPAddr("tcp", l.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.ListenTCP("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	log.Infof("Waiting for UAVTalk TCP connection on %s", listener.Addr())
+	if err := listener.SetDeadline(time.Now().Add(l.config.Timeout)); err != nil {
+		return nil, err
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("No TCP connection on %s: %s", l.config.Address, err)
+	}
+	log.Infof("UAVTalk TCP connection from %s", conn.RemoteAddr())
+	return l.setupConn(conn)
+}
+
+// setupConn disables Nagle's algorithm, UAVTalk frames are small and latency matters
+func (l *tcpLink) setupConn(conn net.Conn) (*net.TCPConn, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if ok == false {
+		conn.Close()
+		return nil, fmt.Errorf("Not a TCP connection: %s", conn.RemoteAddr())
+	}
+	if err := tcpConn.SetNoDelay(true); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	if err := tcpConn.SetKeepAlive(true); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	if err := tcpConn.SetKeepAlivePeriod(l.config.KeepAlive); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	return tcpConn, nil
+}
+
+func (l *tcpLink) Read(b []byte) (int, error) {
+	return l.conn.Read(b)
+}
+
+func (l *tcpLink) Write(b []byte) (int, error) {
+	return l.conn.Write(b)
+}
+
+func (l *tcpLink) Close() error {
+	return l.conn.Close()
+}
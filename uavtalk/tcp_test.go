@@ -0,0 +1,123 @@
+package uavtalk
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// freeTCPAddress returns a loopback address nothing listens on
+func freeTCPAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// testRoundTrip writes on one end and reads it on the other, both ways
+func testRoundTrip(t *testing.T, link io.ReadWriter, peer io.ReadWriter) {
+	for _, ends := range []struct {
+		from, to io.ReadWriter
+	}{{link, peer}, {peer, link}} {
+		data := []byte{0x3c, 0x20, 0x0a, 0x00}
+		if _, err := ends.from.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		received := make([]byte, len(data))
+		if _, err := io.ReadFull(ends.to, received); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(received, data) == false {
+			t.Errorf("read % x, expected % x", received, data)
+		}
+	}
+}
+
+func TestTCPLinkDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// the peer is lost, then accepts the link again
+	for i := 0; i < 2; i++ {
+		link, err := NewTCPLink(TCPConfig{Address: listener.Addr().String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer, err := listener.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRoundTrip(t, link, peer)
+
+		peer.Close()
+		if _, err := link.Read(make([]byte, 1)); err == nil {
+			t.Error("read after the peer closed the connection")
+		}
+		link.Close()
+	}
+}
+
+func TestTCPLinkDialError(t *testing.T) {
+	if _, err := NewTCPLink(TCPConfig{Address: freeTCPAddress(t), Timeout: time.Second}); err == nil {
+		t.Error("dialed nothing")
+	}
+}
+
+// dialTCP dials address until something listens on it
+func dialTCP(t *testing.T, address string) net.Conn {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			return conn
+		}
+	}
+	t.Fatalf("nothing listens on %s", address)
+	return nil
+}
+
+func TestTCPLinkListen(t *testing.T) {
+	address := freeTCPAddress(t)
+
+	// the peer is lost, then connects again
+	for i := 0; i < 2; i++ {
+		type opened struct {
+			link Linker
+			err  error
+		}
+		links := make(chan opened)
+		go func() {
+			link, err := NewTCPLink(TCPConfig{Address: address, Listen: true})
+			links <- opened{link, err}
+		}()
+
+		peer := dialTCP(t, address)
+		result := <-links
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		testRoundTrip(t, result.link, peer)
+
+		peer.Close()
+		if _, err := result.link.Read(make([]byte, 1)); err == nil {
+			t.Error("read after the peer closed the connection")
+		}
+		result.link.Close()
+	}
+}
+
+func TestTCPLinkListenTimeout(t *testing.T) {
+	start := time.Now()
+	if _, err := NewTCPLink(TCPConfig{Address: "127.0.0.1:0", Listen: true, Timeout: 50 * time.Millisecond}); err == nil {
+		t.Fatal("accepted a connection from nobody")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %s, the timeout is 50ms", elapsed)
+	}
+}
@@ -0,0 +1,238 @@
+package uavtalk
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * Telemetry runs the ground side of the telemetry connection, as the Tau Labs GCS does:
+ *	GCSTelemetryStats Disconnected -> HandshakeReq, until FlightTelemetryStats HandshakeAck is received
+ *	-> Connected, as long as FlightTelemetryStats keeps coming with the Connected status
+ * GCSTelemetryStats is sent every second until connected, then every 4 seconds,
+ * with the traffic rates and failure counts of the connection.
+ * The connection is lost when the flight controller reports another status, or stays silent for 8 seconds.
+ *
+ * Telemetry does not read the connection, link states and FlightTelemetryStats packets have to be given to it,
+ * eg. by the handlers reading the connection. Giving them never blocks: when the telemetry lags behind,
+ * older FlightTelemetryStats are dropped, and only the last link state is kept.
+ */
+
+// TelemetryStatus is the status of the telemetry connection, named as the GCSTelemetryStats Status options
+type TelemetryStatus int
+
+// telemetry statuses
+const (
+	TelemetryDisconnected TelemetryStatus = iota
+	TelemetryHandshakeReq
+	TelemetryConnected
+)
+
+func (status TelemetryStatus) String() string {
+	switch status {
+	case TelemetryHandshakeReq:
+		return "HandshakeReq"
+	case TelemetryConnected:
+		return "Connected"
+	}
+	return "Disconnected"
+}
+
+const telemetryConnectPeriod = 1 * time.Second
+const telemetryUpdatePeriod = 4 * time.Second
+const telemetryTimeout = 8 * time.Second
+
+// Telemetry manages the telemetry connection of a Connection
+type Telemetry struct {
+	ConnectPeriod time.Duration // between GCSTelemetryStats until connected
+	UpdatePeriod  time.Duration // between GCSTelemetryStats once connected
+	Timeout       time.Duration // without FlightTelemetryStats before the connection is lost
+
+	connection *Connection
+	packets    chan Packet
+	linkStates chan LinkState
+
+	mutex     sync.RWMutex
+	status    TelemetryStatus
+	callbacks []func(TelemetryStatus)
+
+	// owned by the Start goroutine
+	linkUp          bool
+	flightStatus    string
+	lastFlightStats time.Time
+	lastStats       LinkStats
+	lastUpdate      time.Time
+	nextUpdate      time.Time
+}
+
+// NewTelemetry creates the telemetry of a connection, nothing happens until Start is called, the periods can be changed until then
+func NewTelemetry(connection *Connection) *Telemetry {
+	return &Telemetry{
+		ConnectPeriod: telemetryConnectPeriod,
+		UpdatePeriod:  telemetryUpdatePeriod,
+		Timeout:       telemetryTimeout,
+		connection:    connection,
+		packets:       make(chan Packet, 10),
+		linkStates:    make(chan LinkState, 1),
+	}
+}
+
+// OnStatusChange registers a callback, called from the telemetry goroutine on each status change, it must not block
+func (t *Telemetry) OnStatusChange(callback func(status TelemetryStatus)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.callbacks = append(t.callbacks, callback)
+}
+
+// Status returns the current status
+func (t *Telemetry) Status() TelemetryStatus {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.status
+}
+
+// HandlePacket takes the packets received from the flight controller, only FlightTelemetryStats is used
+func (t *Telemetry) HandlePacket(packet Packet) {
+	if packet.Definition.Name != "FlightTelemetryStats" || (packet.Cmd != ObjectCmd && packet.Cmd != ObjectCmdWithAck) {
+		return
+	}
+	select {
+	case t.packets <- packet:
+	default:
+		log.Warningf("%s: FlightTelemetryStats dropped, the telemetry does not keep up", t.connection.LinkURI)
+	}
+}
+
+// HandleLinkState takes the link state changes of the connection, a state not handled yet is replaced,
+// each state starts the handshake over
+func (t *Telemetry) HandleLinkState(state LinkState) {
+	for {
+		select {
+		case t.linkStates <- state:
+			return
+		default:
+		}
+		select {
+		case <-t.linkStates:
+		default:
+		}
+	}
+}
+
+// Start runs the telemetry, it never returns
+func (t *Telemetry) Start() {
+	t.nextUpdate = time.Now().Add(t.ConnectPeriod)
+	timer := time.NewTimer(t.ConnectPeriod)
+	for {
+		select {
+		case state := <-t.linkStates:
+			t.linkUp = state == LinkUp
+			t.flightStatus = ""
+			t.setStatus(TelemetryDisconnected)
+			if t.linkUp {
+				t.update()
+			}
+		case packet := <-t.packets:
+			t.flightStatus, _ = packet.Data["Status"].(string)
+			t.lastFlightStats = time.Now()
+			// the handshake goes on right away, as soon as the flight controller answers
+			if t.Status() != TelemetryConnected || t.flightStatus != "Connected" {
+				t.update()
+			}
+		case <-timer.C:
+			if t.linkUp {
+				t.update()
+			} else {
+				t.nextUpdate = time.Now().Add(t.ConnectPeriod)
+			}
+		}
+
+		if timer.Stop() == false {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(t.nextUpdate.Sub(time.Now()))
+	}
+}
+
+// update moves the status forward, and sends GCSTelemetryStats
+func (t *Telemetry) update() {
+	now := time.Now()
+	status := t.Status()
+
+	switch status {
+	case TelemetryDisconnected:
+		status = TelemetryHandshakeReq
+	case TelemetryHandshakeReq:
+		if t.flightStatus == "HandshakeAck" {
+			status = TelemetryConnected
+		}
+	case TelemetryConnected:
+		if now.Sub(t.lastFlightStats) > t.Timeout {
+			log.Warningf("%s: no FlightTelemetryStats for %s", t.connection.LinkURI, now.Sub(t.lastFlightStats))
+			status = TelemetryDisconnected
+		} else if t.flightStatus != "Connected" {
+			log.Warningf("%s: flight controller telemetry %s", t.connection.LinkURI, t.flightStatus)
+			status = TelemetryDisconnected
+		}
+	}
+	t.setStatus(status)
+	t.sendStats(now, status)
+
+	if status == TelemetryConnected {
+		t.nextUpdate = now.Add(t.UpdatePeriod)
+	} else {
+		t.nextUpdate = now.Add(t.ConnectPeriod)
+	}
+}
+
+func (t *Telemetry) sendStats(now time.Time, status TelemetryStatus) {
+	stats := t.connection.Stats()
+	var txRate, rxRate float64
+	if elapsed := now.Sub(t.lastUpdate).Seconds(); t.lastUpdate.IsZero() == false && elapsed > 0 {
+		txRate = float64(stats.TxBytes-t.lastStats.TxBytes) / elapsed
+		rxRate = float64(stats.RxBytes-t.lastStats.RxBytes) / elapsed
+	}
+	t.lastStats, t.lastUpdate = stats, now
+
+	definition, err := t.connection.Registry().GetDefinitionForName("GCSTelemetryStats")
+	if err != nil {
+		log.Warning(err)
+		return
+	}
+	packet := NewPacket(definition, ObjectCmd, 0, map[string]interface{}{
+		"Status":     status.String(),
+		"TxDataRate": txRate,
+		"RxDataRate": rxRate,
+		"TxFailures": float64(uint32(stats.TxFailures)),
+		"RxFailures": float64(uint32(stats.RxFailures)),
+		"TxRetries":  float64(uint32(stats.TxRetries)),
+	})
+
+	// the link may be stuck, the telemetry must not be
+	select {
+	case t.connection.InChan <- *packet:
+	default:
+		log.Warningf("%s: GCSTelemetryStats dropped, the link does not keep up", t.connection.LinkURI)
+	}
+}
+
+func (t *Telemetry) setStatus(status TelemetryStatus) {
+	t.mutex.Lock()
+	if t.status == status {
+		t.mutex.Unlock()
+		return
+	}
+	t.status = status
+	callbacks := t.callbacks
+	t.mutex.Unlock()
+
+	log.Infof("%s: telemetry %s", t.connection.LinkURI, status)
+	for _, callback := range callbacks {
+		callback(status)
+	}
+}
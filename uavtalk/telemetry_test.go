@@ -0,0 +1,166 @@
+package uavtalk
+
+import (
+	"testing"
+	"time"
+)
+
+// coreRegistry loads the definitions of the core set, which hold the telemetry objects
+func coreRegistry(t *testing.T) *Registry {
+	files, err := ReadDefinitionFiles("definitions/core/xml/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewRegistryFromFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+// telemetryTest runs a Telemetry on a connection which is not started, what it sends is read from InChan
+type telemetryTest struct {
+	*testing.T
+	telemetry   *Telemetry
+	connection  *Connection
+	flightStats *Definition
+	statuses    chan TelemetryStatus
+}
+
+func newTelemetryTest(t *testing.T) *telemetryTest {
+	registry := coreRegistry(t)
+	connection := NewConnection("test://telemetry", registry)
+	telemetry := NewTelemetry(connection)
+	telemetry.ConnectPeriod = 50 * time.Millisecond
+	telemetry.UpdatePeriod = 200 * time.Millisecond
+	telemetry.Timeout = 400 * time.Millisecond
+
+	test := &telemetryTest{
+		T:           t,
+		telemetry:   telemetry,
+		connection:  connection,
+		flightStats: testDefinition(t, registry, "FlightTelemetryStats"),
+		statuses:    make(chan TelemetryStatus, 10),
+	}
+	telemetry.OnStatusChange(func(status TelemetryStatus) {
+		test.statuses <- status
+	})
+	go telemetry.Start()
+	return test
+}
+
+// sent returns the status of the next GCSTelemetryStats sent
+func (t *telemetryTest) sent() string {
+	select {
+	case packet := <-t.connection.InChan:
+		if packet.Definition.Name != "GCSTelemetryStats" || packet.Cmd != ObjectCmd {
+			t.Fatalf("%s %d sent, expected GCSTelemetryStats", packet.Definition.Name, packet.Cmd)
+		}
+		return packet.Data["Status"].(string)
+	case <-time.After(time.Second):
+		t.Fatal("GCSTelemetryStats not sent")
+	}
+	return ""
+}
+
+func (t *telemetryTest) expectSent(expected string) {
+	if status := t.sent(); status != expected {
+		t.Fatalf("GCSTelemetryStats %s sent, expected %s", status, expected)
+	}
+}
+
+func (t *telemetryTest) expectStatus(expected TelemetryStatus) {
+	select {
+	case status := <-t.statuses:
+		if status != expected {
+			t.Fatalf("telemetry %s, expected %s", status, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("telemetry not %s", expected)
+	}
+}
+
+func (t *telemetryTest) flightStatus(status string) {
+	t.telemetry.HandlePacket(*NewPacket(t.flightStats, ObjectCmd, 0, map[string]interface{}{"Status": status}))
+}
+
+func TestTelemetryDefaults(t *testing.T) {
+	telemetry := NewTelemetry(NewConnection("test://telemetry", coreRegistry(t)))
+	if telemetry.ConnectPeriod != time.Second || telemetry.UpdatePeriod != 4*time.Second || telemetry.Timeout != 8*time.Second {
+		t.Errorf("periods %s, %s, timeout %s, expected 1s, 4s, 8s", telemetry.ConnectPeriod, telemetry.UpdatePeriod, telemetry.Timeout)
+	}
+}
+
+func TestTelemetryHandshake(t *testing.T) {
+	test := newTelemetryTest(t)
+
+	// nothing is sent while the link is down
+	select {
+	case packet := <-test.connection.InChan:
+		t.Fatalf("%s sent while the link is down", packet.Definition.Name)
+	case <-time.After(3 * test.telemetry.ConnectPeriod):
+	}
+
+	test.telemetry.HandleLinkState(LinkUp)
+	test.expectStatus(TelemetryHandshakeReq)
+	test.expectSent("HandshakeReq")
+
+	// HandshakeReq is sent every ConnectPeriod until answered
+	start := time.Now()
+	test.expectSent("HandshakeReq")
+	if elapsed := time.Since(start); elapsed < test.telemetry.ConnectPeriod/2 {
+		t.Errorf("HandshakeReq sent again after %s, the period is %s", elapsed, test.telemetry.ConnectPeriod)
+	}
+
+	test.flightStatus("HandshakeAck")
+	test.expectStatus(TelemetryConnected)
+	test.expectSent("Connected")
+
+	// once connected, GCSTelemetryStats is sent every UpdatePeriod
+	start = time.Now()
+	test.flightStatus("Connected")
+	test.expectSent("Connected")
+	if elapsed := time.Since(start); elapsed < test.telemetry.UpdatePeriod*3/4 {
+		t.Errorf("GCSTelemetryStats sent after %s once connected, the period is %s", elapsed, test.telemetry.UpdatePeriod)
+	}
+
+	// the handshake starts over when the flight controller is not connected anymore
+	test.flightStatus("Disconnected")
+	test.expectStatus(TelemetryDisconnected)
+	test.expectSent("Disconnected")
+	test.expectStatus(TelemetryHandshakeReq)
+	test.expectSent("HandshakeReq")
+	test.flightStatus("HandshakeAck")
+	test.expectStatus(TelemetryConnected)
+	test.expectSent("Connected")
+
+	// and when the link goes down
+	test.telemetry.HandleLinkState(LinkDown)
+	test.expectStatus(TelemetryDisconnected)
+	select {
+	case packet := <-test.connection.InChan:
+		t.Errorf("%s %v sent once the link is down", packet.Definition.Name, packet.Data["Status"])
+	case <-time.After(3 * test.telemetry.ConnectPeriod):
+	}
+}
+
+func TestTelemetryTimeout(t *testing.T) {
+	test := newTelemetryTest(t)
+
+	test.telemetry.HandleLinkState(LinkUp)
+	test.expectStatus(TelemetryHandshakeReq)
+	test.expectSent("HandshakeReq")
+	test.flightStatus("HandshakeAck")
+	test.expectStatus(TelemetryConnected)
+	test.expectSent("Connected")
+
+	// the flight controller stays silent
+	start := time.Now()
+	test.flightStatus("Connected")
+	for status := test.sent(); status == "Connected"; status = test.sent() {
+	}
+	if elapsed := time.Since(start); elapsed < test.telemetry.Timeout {
+		t.Errorf("disconnected after %s without FlightTelemetryStats, the timeout is %s", elapsed, test.telemetry.Timeout)
+	}
+	test.expectStatus(TelemetryDisconnected)
+}
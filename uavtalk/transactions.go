@@ -0,0 +1,266 @@
+package uavtalk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * Transactions track the packets which expect an answer from the flight controller:
+ *	ObjectCmdWithAck is answered by ObjectAck or ObjectNack
+ *	ObjectRequest is answered by the object (ObjectCmd or ObjectCmdWithAck) or ObjectNack
+ * Transactions are keyed by object ID and instance ID, as the answers, only one per key is in flight,
+ * the others wait in line. A packet which is not answered in time is sent again, Retries times,
+ * then the transaction times out.
+ * The results are given to a callback, or waited for, from the Transaction returned by Send.
+ *
+ * Transactions does not read the connection, link states and packets have to be given to it,
+ * eg. by the handlers reading the connection. Nothing is sent while the link is down, nor written while the definitions
+ * are not verified (see Connection.Send). The connection drops what is queued before reporting the link down,
+ * so the transactions pending then can be ended.
+ */
+
+const defaultTransactionTimeout = 1 * time.Second
+const defaultTransactionRetries = 2
+
+// TransactionStatus is the outcome of a transaction
+type TransactionStatus int
+
+// transaction statuses
+const (
+	TransactionAcked   TransactionStatus = iota // acked, or answered for requests
+	TransactionNacked                           // refused by the flight controller
+	TransactionTimeout                          // not answered, not sent, or the link went down
+)
+
+func (status TransactionStatus) String() string {
+	switch status {
+	case TransactionAcked:
+		return "acked"
+	case TransactionNacked:
+		return "nacked"
+	}
+	return "timeout"
+}
+
+// TransactionResult is given once a transaction is over
+type TransactionResult struct {
+	Status TransactionStatus
+	Packet *Packet // the packet sent
+	Reply  *Packet // the answer, nil on timeout
+	Err    error   // why the transaction did not succeed
+}
+
+// Transaction is a packet waiting for its answer
+type Transaction struct {
+	packet   *Packet
+	callback func(TransactionResult)
+	retries  int
+	timer    *time.Timer
+	done     chan struct{}
+	result   TransactionResult
+}
+
+// Wait waits for the end of the transaction
+func (t *Transaction) Wait() TransactionResult {
+	<-t.done
+	return t.result
+}
+
+// Done is closed once the transaction is over
+func (t *Transaction) Done() <-chan struct{} {
+	return t.done
+}
+
+type transactionKey struct {
+	objectID   uint32
+	instanceID uint16
+}
+
+// Transactions manages the transactions of a connection
+type Transactions struct {
+	Timeout time.Duration // before sending again
+	Retries int           // number of times a packet is sent again
+
+	connection *Connection
+
+	mutex   sync.Mutex
+	pending map[transactionKey][]*Transaction // the first one of each line is in flight
+}
+
+// NewTransactions creates the transaction manager of a connection
+func NewTransactions(connection *Connection) *Transactions {
+	return &Transactions{
+		Timeout:    defaultTransactionTimeout,
+		Retries:    defaultTransactionRetries,
+		connection: connection,
+		pending:    map[transactionKey][]*Transaction{},
+	}
+}
+
+// Send sends a packet expecting an answer, ObjectCmdWithAck or ObjectRequest,
+// callback is called once the transaction is over, from another goroutine, it can be nil
+func (t *Transactions) Send(packet *Packet, callback func(TransactionResult)) (*Transaction, error) {
+	if packet.Cmd != ObjectCmdWithAck && packet.Cmd != ObjectRequest {
+		return nil, fmt.Errorf("%s: command %d is not answered", packet.Definition.Name, packet.Cmd)
+	}
+	if err := t.connection.CheckSend(*packet); err != nil {
+		return nil, err
+	}
+
+	transaction := &Transaction{
+		packet:   packet,
+		callback: callback,
+		done:     make(chan struct{}),
+	}
+	key := transactionKey{packet.Definition.ObjectID, packet.InstanceID}
+
+	t.mutex.Lock()
+	t.pending[key] = append(t.pending[key], transaction)
+	first := len(t.pending[key]) == 1
+	if first {
+		t.arm(key, transaction)
+	}
+	t.mutex.Unlock()
+
+	if first {
+		t.send(key, transaction)
+	}
+	return transaction, nil
+}
+
+// HandlePacket takes the packets received from the flight controller, answers end their transaction
+func (t *Transactions) HandlePacket(packet Packet) {
+	key := transactionKey{packet.Definition.ObjectID, packet.InstanceID}
+
+	t.mutex.Lock()
+	line := t.pending[key]
+	if len(line) == 0 {
+		t.mutex.Unlock()
+		return
+	}
+
+	transaction := line[0]
+	status := TransactionAcked
+	var err error
+	switch {
+	case packet.Cmd == ObjectNack:
+		status, err = TransactionNacked, fmt.Errorf("%s: nacked", packet.Definition.Name)
+	case packet.Cmd == ObjectAck && transaction.packet.Cmd == ObjectCmdWithAck:
+	case (packet.Cmd == ObjectCmd || packet.Cmd == ObjectCmdWithAck) && transaction.packet.Cmd == ObjectRequest:
+	default:
+		t.mutex.Unlock()
+		return
+	}
+	next := t.finish(key, transaction)
+	t.mutex.Unlock()
+
+	t.resolve(transaction, TransactionResult{status, transaction.packet, &packet, err})
+	t.send(key, next)
+}
+
+// HandleLinkState takes the link state changes of the connection, the transactions end when the link goes down
+func (t *Transactions) HandleLinkState(state LinkState) {
+	if state != LinkDown {
+		return
+	}
+
+	t.mutex.Lock()
+	pending := t.pending
+	t.pending = map[transactionKey][]*Transaction{}
+	t.mutex.Unlock()
+
+	for _, line := range pending {
+		for _, transaction := range line {
+			if transaction.timer != nil {
+				transaction.timer.Stop()
+			}
+			t.resolve(transaction, TransactionResult{TransactionTimeout, transaction.packet, nil, errLinkDown})
+		}
+	}
+}
+
+// arm starts the timeout of the transaction in flight, the mutex has to be held
+func (t *Transactions) arm(key transactionKey, transaction *Transaction) {
+	transaction.timer = time.AfterFunc(t.Timeout, func() {
+		t.timeout(key, transaction)
+	})
+}
+
+func (t *Transactions) timeout(key transactionKey, transaction *Transaction) {
+	t.mutex.Lock()
+	line := t.pending[key]
+	if len(line) == 0 || line[0] != transaction {
+		// answered meanwhile
+		t.mutex.Unlock()
+		return
+	}
+
+	if transaction.retries < t.Retries {
+		transaction.retries++
+		t.arm(key, transaction)
+		t.mutex.Unlock()
+
+		t.connection.countRetry()
+		if err := t.connection.Send(*transaction.packet); err != nil {
+			log.Warningf("%s: not sent again: %s", t.connection.LinkURI, err)
+		}
+		return
+	}
+
+	next := t.finish(key, transaction)
+	t.mutex.Unlock()
+
+	err := fmt.Errorf("%s: no answer after %d tries", transaction.packet.Definition.Name, transaction.retries+1)
+	t.resolve(transaction, TransactionResult{TransactionTimeout, transaction.packet, nil, err})
+	t.send(key, next)
+}
+
+// finish removes the transaction in flight, and returns the next one of the line, the mutex has to be held
+func (t *Transactions) finish(key transactionKey, transaction *Transaction) *Transaction {
+	transaction.timer.Stop()
+
+	line := t.pending[key][1:]
+	if len(line) == 0 {
+		delete(t.pending, key)
+		return nil
+	}
+	t.pending[key] = line
+	t.arm(key, line[0])
+	return line[0]
+}
+
+// send sends the transaction which just got in flight, without blocking, when it can not be sent it fails
+// as if it timed out, and the next one of its line is sent
+func (t *Transactions) send(key transactionKey, transaction *Transaction) {
+	for transaction != nil {
+		err := t.connection.Send(*transaction.packet)
+		if err == nil {
+			return
+		}
+
+		t.mutex.Lock()
+		line := t.pending[key]
+		if len(line) == 0 || line[0] != transaction {
+			// ended meanwhile
+			t.mutex.Unlock()
+			return
+		}
+		next := t.finish(key, transaction)
+		t.mutex.Unlock()
+
+		t.resolve(transaction, TransactionResult{TransactionTimeout, transaction.packet, nil, err})
+		transaction = next
+	}
+}
+
+func (t *Transactions) resolve(transaction *Transaction, result TransactionResult) {
+	transaction.result = result
+	close(transaction.done)
+	if transaction.callback != nil {
+		go transaction.callback(result)
+	}
+}
@@ -0,0 +1,451 @@
+package uavtalk
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLink is a link the tests can fail, its writes block until it is closed when blockWrites is set
+type testLink struct {
+	blockWrites bool
+	writes      chan []byte
+	fail        chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func newTestLink(blockWrites bool) *testLink {
+	return &testLink{
+		blockWrites: blockWrites,
+		writes:      make(chan []byte, 100),
+		fail:        make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (l *testLink) Read(buffer []byte) (int, error) {
+	select {
+	case <-l.fail:
+		return 0, io.EOF
+	case <-l.closed:
+		return 0, errLinkClosed
+	}
+}
+
+func (l *testLink) Write(data []byte) (int, error) {
+	if l.blockWrites {
+		<-l.closed
+		return 0, errLinkClosed
+	}
+	l.writes <- append([]byte(nil), data...)
+	return len(data), nil
+}
+
+func (l *testLink) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+// testLinks hands out the links of test://<host>, in order
+var testLinks = struct {
+	sync.Mutex
+	hosts map[string]chan *testLink
+}{hosts: map[string]chan *testLink{}}
+
+func init() {
+	RegisterLink("test", func(uri *url.URL, registry *Registry) (Linker, error) {
+		testLinks.Lock()
+		links := testLinks.hosts[uri.Host]
+		testLinks.Unlock()
+		return <-links, nil
+	})
+}
+
+// newTestLinks returns the URI of a new test link and the channel its links are taken from
+func newTestLinks() (string, chan *testLink) {
+	testLinks.Lock()
+	defer testLinks.Unlock()
+	host := fmt.Sprintf("link%d", len(testLinks.hosts))
+	testLinks.hosts[host] = make(chan *testLink)
+	return "test://" + host, testLinks.hosts[host]
+}
+
+func waitLinkState(t *testing.T, connection *Connection, expected LinkState) {
+	select {
+	case state := <-connection.StateChan:
+		if state != expected {
+			t.Fatalf("link %s, expected %s", state, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("link not %s", expected)
+	}
+}
+
+// what was queued when the link went down is not sent once it is up again
+func TestTransactionsLinkDown(t *testing.T) {
+	registry := testRegistry(t)
+	definition := testDefinition(t, registry, "AccessoryDesired")
+	uri, links := newTestLinks()
+	connection := NewConnection(uri, registry)
+	transactions := NewTransactions(connection)
+	go connection.Start()
+
+	stalled := newTestLink(true)
+	links <- stalled
+	waitLinkState(t, connection, LinkUp)
+
+	packet := NewPacket(definition, ObjectCmdWithAck, 0, map[string]interface{}{"AccessoryVal": float64(1)})
+	transaction, err := transactions.Send(packet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the writer is stuck on the first one, the others wait in InChan
+	for i := 0; i < 3; i++ {
+		connection.InChan <- *NewPacket(definition, ObjectCmd, uint16(i+1), map[string]interface{}{"AccessoryVal": float64(1)})
+	}
+
+	close(stalled.fail)
+	waitLinkState(t, connection, LinkDown)
+	transactions.HandleLinkState(LinkDown)
+	if result := transaction.Wait(); result.Status != TransactionTimeout {
+		t.Errorf("transaction %s, expected %s", result.Status, TransactionTimeout)
+	}
+
+	if _, err := transactions.Send(packet, nil); err == nil {
+		t.Error("transaction sent while the link is down")
+	}
+	connection.InChan <- *packet
+
+	reopened := newTestLink(false)
+	links <- reopened
+	waitLinkState(t, connection, LinkUp)
+	transactions.HandleLinkState(LinkUp)
+
+	select {
+	case data := <-reopened.writes:
+		t.Errorf("% x written once the link was up again", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if failures := connection.Stats().TxFailures; failures != 5 {
+		t.Errorf("%d packets failed, expected 5", failures)
+	}
+
+	if _, err := transactions.Send(packet, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reopened.writes:
+	case <-time.After(time.Second):
+		t.Error("transaction not sent once the link was up again")
+	}
+
+	close(reopened.fail)
+	waitLinkState(t, connection, LinkDown)
+	transactions.HandleLinkState(LinkDown)
+}
+
+// ObjectPersistence is acked as instance 0, whatever the instance saved
+func TestTransactionsPersist(t *testing.T) {
+	registry := testRegistry(t)
+	uri, links := newTestLinks()
+	connection := NewConnection(uri, registry)
+	transactions := NewTransactions(connection)
+	go connection.Start()
+
+	link := newTestLink(false)
+	links <- link
+	waitLinkState(t, connection, LinkUp)
+
+	packet, err := registry.CreatePersistObject(testDefinition(t, registry, "AccessoryDesired"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction, err := transactions.Send(&packet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frame []byte
+	select {
+	case frame = <-link.writes:
+	case <-time.After(time.Second):
+		t.Fatal("ObjectPersistence not sent")
+	}
+	packets, errs := NewParser(registry).Feed(frame)
+	if len(packets) != 1 || len(errs) != 0 {
+		t.Fatalf("% x: %d packets, errors %v", frame, len(packets), errs)
+	}
+	if sent := packets[0]; sent.InstanceID != 0 || sent.Data["InstanceID"] != uint32(2) {
+		t.Errorf("instance %d sent, saving instance %v", sent.InstanceID, sent.Data["InstanceID"])
+	}
+
+	transactions.HandlePacket(CreatePacketAck(packet.Definition))
+	select {
+	case <-transaction.Done():
+		if result := transaction.Wait(); result.Status != TransactionAcked {
+			t.Errorf("transaction %s, expected %s", result.Status, TransactionAcked)
+		}
+	case <-time.After(time.Second):
+		t.Error("ack not matched")
+	}
+
+	close(link.fail)
+	waitLinkState(t, connection, LinkDown)
+}
+
+// transactionsTest runs Transactions on a connection to a test link
+type transactionsTest struct {
+	*testing.T
+	registry     *Registry
+	connection   *Connection
+	transactions *Transactions
+	link         *testLink
+}
+
+func newTransactionsTest(t *testing.T, link *testLink) *transactionsTest {
+	registry := testRegistry(t)
+	uri, links := newTestLinks()
+	connection := NewConnection(uri, registry)
+	transactions := NewTransactions(connection)
+	transactions.Timeout = 50 * time.Millisecond
+	go connection.Start()
+
+	links <- link
+	waitLinkState(t, connection, LinkUp)
+	return &transactionsTest{t, registry, connection, transactions, link}
+}
+
+func (t *transactionsTest) close() {
+	close(t.link.fail)
+	waitLinkState(t.T, t.connection, LinkDown)
+	t.transactions.HandleLinkState(LinkDown)
+}
+
+// written returns the next packet written to the link, nil if none is
+func (t *transactionsTest) written(wait time.Duration) *Packet {
+	select {
+	case frame := <-t.link.writes:
+		packets, errs := NewParser(t.registry).Feed(frame)
+		if len(packets) != 1 || len(errs) != 0 {
+			t.Fatalf("% x: %d packets, errors %v", frame, len(packets), errs)
+		}
+		return packets[0]
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (t *transactionsTest) wait(transaction *Transaction) TransactionResult {
+	select {
+	case <-transaction.Done():
+		return transaction.Wait()
+	case <-time.After(time.Second):
+		t.Fatalf("%s transaction not over", transaction.packet.Definition.Name)
+	}
+	return TransactionResult{}
+}
+
+func (t *transactionsTest) send(packet *Packet) *Transaction {
+	transaction, err := t.transactions.Send(packet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+// a packet not answered is sent Retries times again, then its transaction times out
+func TestTransactionsRetries(t *testing.T) {
+	for _, retries := range []int{0, 1, 3} {
+		test := newTransactionsTest(t, newTestLink(false))
+		test.transactions.Retries = retries
+		definition := testDefinition(t, test.registry, "AccessoryDesired")
+
+		start := time.Now()
+		transaction := test.send(NewPacket(definition, ObjectCmdWithAck, 1, map[string]interface{}{"AccessoryVal": float64(1)}))
+		result := test.wait(transaction)
+		elapsed := time.Since(start)
+
+		if result.Status != TransactionTimeout || result.Reply != nil {
+			t.Errorf("%d retries: transaction %s, reply %v, expected %s", retries, result.Status, result.Reply, TransactionTimeout)
+		}
+		if expected := fmt.Sprintf("AccessoryDesired: no answer after %d tries", retries+1); result.Err == nil || result.Err.Error() != expected {
+			t.Errorf("%d retries: %v, expected %q", retries, result.Err, expected)
+		}
+		if min := time.Duration(retries+1) * test.transactions.Timeout; elapsed < min {
+			t.Errorf("%d retries: timed out after %s, expected at least %s", retries, elapsed, min)
+		}
+		sent := 0
+		for test.written(50*time.Millisecond) != nil {
+			sent++
+		}
+		if sent != retries+1 {
+			t.Errorf("%d retries: sent %d times, expected %d", retries, sent, retries+1)
+		}
+		if stats := test.connection.Stats(); stats.TxRetries != uint64(retries) {
+			t.Errorf("%d retries: %d retries counted", retries, stats.TxRetries)
+		}
+		test.close()
+	}
+}
+
+func TestTransactionsAnswers(t *testing.T) {
+	registry := testRegistry(t)
+	accessory := testDefinition(t, registry, "AccessoryDesired")
+	data := map[string]interface{}{"AccessoryVal": float64(1)}
+
+	tests := []struct {
+		name    string
+		sent    *Packet
+		answers []*Packet // the last one ends the transaction, the others are ignored
+		status  TransactionStatus
+	}{
+		{"acked", NewPacket(accessory, ObjectCmdWithAck, 1, data), []*Packet{
+			NewPacket(accessory, ObjectAck, 2, map[string]interface{}{}),
+			NewPacket(accessory, ObjectCmd, 1, data),
+			NewPacket(accessory, ObjectAck, 1, map[string]interface{}{}),
+		}, TransactionAcked},
+		{"nacked", NewPacket(accessory, ObjectCmdWithAck, 1, data), []*Packet{
+			NewPacket(accessory, ObjectNack, 1, map[string]interface{}{}),
+		}, TransactionNacked},
+		{"request answered", NewPacket(accessory, ObjectRequest, 1, map[string]interface{}{}), []*Packet{
+			NewPacket(accessory, ObjectAck, 1, map[string]interface{}{}),
+			NewPacket(accessory, ObjectCmd, 1, data),
+		}, TransactionAcked},
+		{"request answered with ack", NewPacket(accessory, ObjectRequest, 1, map[string]interface{}{}), []*Packet{
+			NewPacket(accessory, ObjectCmdWithAck, 1, data),
+		}, TransactionAcked},
+		{"request nacked", NewPacket(accessory, ObjectRequest, 1, map[string]interface{}{}), []*Packet{
+			NewPacket(accessory, ObjectNack, 1, map[string]interface{}{}),
+		}, TransactionNacked},
+	}
+
+	for _, test := range tests {
+		transactionsTest := newTransactionsTest(t, newTestLink(false))
+		transactionsTest.transactions.Timeout = time.Second
+		transaction := transactionsTest.send(test.sent)
+		if transactionsTest.written(time.Second) == nil {
+			t.Fatalf("%s: not sent", test.name)
+		}
+
+		for i, answer := range test.answers {
+			transactionsTest.transactions.HandlePacket(*answer)
+			select {
+			case <-transaction.Done():
+				if i != len(test.answers)-1 {
+					t.Errorf("%s: ended by answer %d", test.name, i)
+				}
+			default:
+				if i == len(test.answers)-1 {
+					t.Errorf("%s: not ended by the answer", test.name)
+				}
+			}
+		}
+
+		result := transactionsTest.wait(transaction)
+		last := test.answers[len(test.answers)-1]
+		if result.Status != test.status || result.Packet != test.sent || result.Reply == nil || result.Reply.Cmd != last.Cmd {
+			t.Errorf("%s: %s, reply %v, expected %s", test.name, result.Status, result.Reply, test.status)
+		}
+		if (result.Status == TransactionAcked) != (result.Err == nil) {
+			t.Errorf("%s: %s, error %v", test.name, result.Status, result.Err)
+		}
+		transactionsTest.close()
+	}
+}
+
+// only one transaction per object instance is in flight, the next one is sent once it is over
+func TestTransactionsQueueing(t *testing.T) {
+	test := newTransactionsTest(t, newTestLink(false))
+	test.transactions.Timeout = time.Second
+	accessory := testDefinition(t, test.registry, "AccessoryDesired")
+	write := func(instanceID uint16, value float64) *Packet {
+		return NewPacket(accessory, ObjectCmdWithAck, instanceID, map[string]interface{}{"AccessoryVal": value})
+	}
+
+	first := test.send(write(1, 1))
+	second := test.send(write(1, 2))
+	other := test.send(write(2, 3))
+
+	for _, expected := range []float32{1, 3} {
+		if packet := test.written(time.Second); packet == nil || packet.Data["AccessoryVal"] != expected {
+			t.Fatalf("%v written, expected AccessoryVal %g", packet, expected)
+		}
+	}
+	if packet := test.written(100 * time.Millisecond); packet != nil {
+		t.Fatalf("%v written while the first transaction of its instance is in flight", packet)
+	}
+
+	test.transactions.HandlePacket(CreatePacketAck(accessory))
+	test.transactions.HandlePacket(*NewPacket(accessory, ObjectAck, 1, map[string]interface{}{}))
+	if result := test.wait(first); result.Status != TransactionAcked {
+		t.Errorf("first transaction %s", result.Status)
+	}
+	if packet := test.written(time.Second); packet == nil || packet.Data["AccessoryVal"] != float32(2) {
+		t.Fatalf("%v written once the first transaction is over, expected the second one", packet)
+	}
+
+	select {
+	case <-second.Done():
+		t.Error("second transaction ended by the ack of the first one")
+	default:
+	}
+	test.transactions.HandlePacket(*NewPacket(accessory, ObjectAck, 1, map[string]interface{}{}))
+	test.transactions.HandlePacket(*NewPacket(accessory, ObjectAck, 2, map[string]interface{}{}))
+	for _, transaction := range []*Transaction{second, other} {
+		if result := test.wait(transaction); result.Status != TransactionAcked {
+			t.Errorf("transaction %s", result.Status)
+		}
+	}
+	test.close()
+}
+
+// Send never blocks, a packet which can not be queued fails its transaction, the next one of its line is sent
+func TestTransactionsLinkBusy(t *testing.T) {
+	test := newTransactionsTest(t, newTestLink(true))
+	test.transactions.Timeout = time.Second
+	accessory := testDefinition(t, test.registry, "AccessoryDesired")
+	write := NewPacket(accessory, ObjectCmdWithAck, 1, map[string]interface{}{"AccessoryVal": float64(1)})
+
+	// the writer is stuck on the first one
+	first := test.send(write)
+	for deadline := time.Now().Add(time.Second); len(test.connection.InChan) > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("first transaction not written")
+		}
+	}
+	second := test.send(write)
+	third := test.send(write)
+	for len(test.connection.InChan) < cap(test.connection.InChan) {
+		test.connection.InChan <- *NewPacket(accessory, ObjectCmd, 2, map[string]interface{}{"AccessoryVal": float64(1)})
+	}
+
+	done := make(chan *Transaction)
+	go func() {
+		done <- test.send(NewPacket(accessory, ObjectCmdWithAck, 3, map[string]interface{}{"AccessoryVal": float64(1)}))
+	}()
+	select {
+	case transaction := <-done:
+		result := test.wait(transaction)
+		if result.Status != TransactionTimeout || result.Err == nil || result.Err.Error() != "AccessoryDesired: the link does not keep up" {
+			t.Errorf("transaction %s: %v, expected to fail as the link does not keep up", result.Status, result.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked on a full InChan")
+	}
+
+	// the second one can not be sent either once the first is over, the third one neither
+	test.transactions.HandlePacket(*NewPacket(accessory, ObjectAck, 1, map[string]interface{}{}))
+	if result := test.wait(first); result.Status != TransactionAcked {
+		t.Errorf("first transaction %s", result.Status)
+	}
+	for _, transaction := range []*Transaction{second, third} {
+		if result := test.wait(transaction); result.Status != TransactionTimeout || result.Err == nil {
+			t.Errorf("transaction %s: %v, expected to fail", result.Status, result.Err)
+		}
+	}
+	test.close()
+}
@@ -4,22 +4,17 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"time"
-
-	log "github.com/Sirupsen/logrus"
 )
 
-var AllDefinitions Definitions
-var maxUAVObjectLength int
-
 // TODO: refactor for better value reading (encoding/binary ?)
-// See uavtalk.cpp state machine pattern in GCS
-// see parsing in rotonde HID
 
+const syncByte = 0x3c
 const versionMask = 0x20
+const typeMask = 0x07
+const timestampedMask = 0x80
+const timestampLength = 2
 const shortHeaderLength = 8
 
 const MaxHIDFrameSize = 64
@@ -37,16 +32,24 @@ type Packet struct {
 	Length     uint16
 	InstanceID uint16
 	Data       map[string]interface{}
+
+	// Timestamped packets carry the time at which the flight controller sent them, in ms, wrapping at 65536
+	Timestamped bool
+	Timestamp   uint16
 }
 
 func (packet *Packet) toBinary() ([]byte, error) {
 	writer := new(bytes.Buffer)
 
-	if err := binary.Write(writer, binary.LittleEndian, uint8(0x3c)); err != nil {
+	if err := binary.Write(writer, binary.LittleEndian, uint8(syncByte)); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Write(writer, binary.LittleEndian, packet.Cmd|versionMask); err != nil {
+	packetType := packet.Cmd | versionMask
+	if packet.Timestamped {
+		packetType |= timestampedMask
+	}
+	if err := binary.Write(writer, binary.LittleEndian, packetType); err != nil {
 		return nil, err
 	}
 
@@ -64,6 +67,12 @@ func (packet *Packet) toBinary() ([]byte, error) {
 		}
 	}
 
+	if packet.Timestamped {
+		if err := binary.Write(writer, binary.LittleEndian, packet.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+
 	if packet.Cmd == ObjectCmd || packet.Cmd == ObjectCmdWithAck {
 		data, err := mapToUAVTalk(packet.Definition, packet.Data)
 		if err != nil {
@@ -99,59 +108,37 @@ func byteArrayToInt16(b []byte) uint16 {
 	return (uint16(b[1]) << 8) | (uint16(b[0]))
 }
 
-func packetComplete(buffer []byte) (bool, int, int, error) {
-	start := 0
-	for {
-		offset := -1
-		for i := start; i < len(buffer)-shortHeaderLength+1; i++ {
-			if buffer[i] == 0x3c {
-				offset = i
-				break
-			}
-		}
-
-		if offset < 0 {
-			return false, 0, 0, nil
-		}
-
-		length := byteArrayToInt16(buffer[offset+2 : offset+4])
-
-		if int(length) > maxUAVObjectLength+shortHeaderLength+2 {
-			start = offset + 1
-			continue
-		}
-
-		if int(length)+1 > len(buffer)-offset {
-			return false, 0, 0, nil
-		}
-
-		cks := buffer[offset+int(length)]
-
-		if cks != computeCrc8(0, buffer[offset:offset+int(length)]) {
-			return false, offset, offset + int(length) + 1, fmt.Errorf("Wrong crc8")
-		}
-
-		return true, offset, offset + int(length) + 1, nil
-	}
-}
-
-func newPacketFromBinary(binaryPacket []byte) (*Packet, error) {
+func newPacketFromBinary(registry *Registry, binaryPacket []byte) (*Packet, error) {
 	headerSize := shortHeaderLength
 	buffer := Packet{}
 
-	buffer.Cmd = binaryPacket[1] ^ versionMask
+	buffer.Cmd = binaryPacket[1] & typeMask
+	buffer.Timestamped = binaryPacket[1]&timestampedMask != 0
 	buffer.Length = byteArrayToInt16(binaryPacket[2:4])
 	objectID := byteArrayToInt32(binaryPacket[4:8])
 
 	var err error
-	buffer.Definition, err = AllDefinitions.GetDefinitionForObjectID(objectID)
+	buffer.Definition, err = registry.GetDefinitionForObjectID(objectID)
 	if err != nil {
 		return nil, err
 	}
+	instanceIDOffset := headerSize
 	if buffer.Definition.SingleInstance == false {
-		buffer.InstanceID = byteArrayToInt16(binaryPacket[8:10])
 		headerSize += 2
 	}
+	timestampOffset := headerSize
+	if buffer.Timestamped {
+		headerSize += timestampLength
+	}
+	if len(binaryPacket) < headerSize+1 {
+		return nil, fmt.Errorf("Packet too short for %s: %d bytes", buffer.Definition.Name, len(binaryPacket))
+	}
+	if buffer.Definition.SingleInstance == false {
+		buffer.InstanceID = byteArrayToInt16(binaryPacket[instanceIDOffset : instanceIDOffset+2])
+	}
+	if buffer.Timestamped {
+		buffer.Timestamp = byteArrayToInt16(binaryPacket[timestampOffset : timestampOffset+timestampLength])
+	}
 
 	binaryData := binaryPacket[headerSize : len(binaryPacket)-1]
 
@@ -167,6 +154,25 @@ func newPacketFromBinary(binaryPacket []byte) (*Packet, error) {
 	return &buffer, nil
 }
 
+// DecodePacket decodes a complete binary packet, from the sync byte to the crc included
+func DecodePacket(registry *Registry, binaryPacket []byte) (*Packet, error) {
+	if len(binaryPacket) < shortHeaderLength+1 {
+		return nil, fmt.Errorf("Packet too short: %d bytes", len(binaryPacket))
+	}
+	if binaryPacket[0] != syncByte {
+		return nil, fmt.Errorf("Wrong sync byte: %.02x", binaryPacket[0])
+	}
+	if computeCrc8(0, binaryPacket[:len(binaryPacket)-1]) != binaryPacket[len(binaryPacket)-1] {
+		return nil, fmt.Errorf("Wrong crc8")
+	}
+	return newPacketFromBinary(registry, binaryPacket)
+}
+
+// MarshalBinary encodes the packet as sent on the link, crc included
+func (packet *Packet) MarshalBinary() ([]byte, error) {
+	return packet.toBinary()
+}
+
 func NewPacket(definition *Definition, cmd uint8, instanceID uint16, data map[string]interface{}) *Packet {
 	buffer := Packet{}
 	buffer.Definition = definition
@@ -187,150 +193,55 @@ func NewPacket(definition *Definition, cmd uint8, instanceID uint16, data map[st
 	return &buffer
 }
 
-func LoadDefinitions(definitionsDir string) {
-	defs, err := newDefinitions(definitionsDir)
-	if err != nil {
-		log.Fatal(err)
-	}
-	AllDefinitions = defs
+// NewTimestampedPacket creates a packet carrying a timestamp, only ObjectCmd and ObjectCmdWithAck can be timestamped
+func NewTimestampedPacket(definition *Definition, cmd uint8, instanceID uint16, timestamp uint16, data map[string]interface{}) *Packet {
+	buffer := NewPacket(definition, cmd, instanceID, data)
+	buffer.Timestamped = true
+	buffer.Timestamp = timestamp
+	buffer.Length += timestampLength
+	return buffer
 }
 
-// Start starts the UAVTalk connection to dispatcher
-func Start(inChan chan Packet, outChan chan Packet) {
-	for _, definition := range AllDefinitions {
-		tmp := definition.Fields.ByteLength()
-		tmp += shortHeaderLength
-		if definition.SingleInstance == false {
-			tmp += 2
-		}
-		if tmp > maxUAVObjectLength {
-			maxUAVObjectLength = tmp
+// newDefinitions creates the definitions of all the xml files, in file name order
+func newDefinitions(files DefinitionFiles) (Definitions, error) {
+	definitions := make([]*Definition, 0, 150)
+	for _, name := range files.Names() {
+		definition, err := newDefinition(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
 		}
-	}
-
-	log.Infof("%d xml files loaded, maxUAVObjectLength: %d", len(AllDefinitions), maxUAVObjectLength)
-
-	for {
-		start(inChan, outChan)
-	}
-}
-
-func start(inChan chan Packet, outChan chan Packet) {
-	var link Linker
-	var err error
-	for {
-		link, err = NewUSBLink() // newUSBLink() ou newTCPLink()
+		_, err = NewMetaDefinition(definition)
 		if err != nil {
-			log.Warning(err)
-			time.Sleep(1 * time.Second)
-			continue
+			return nil, fmt.Errorf("%s: %s", name, err)
 		}
-		break
+		definitions = append(definitions, definition, definition.Meta)
 	}
-
-	defer link.Close()
-	// From Controller
-	go func() {
-		packet := make([]byte, MaxHIDFrameSize)
-		buffer := make([]byte, 0, 4096)
-		for {
-			n, err := link.Read(packet)
-			if err != nil {
-				log.Fatal(err)
-				return
-			}
-			if n == 0 {
-				continue
-			}
-
-			buffer = append(buffer, packet[0:n]...)
-
-			for {
-				ok, from, to, err := packetComplete(buffer)
-				if err == nil {
-					if ok != true {
-						break
-					}
-
-					if uavTalkObject, err := newPacketFromBinary(buffer[from:to]); err == nil {
-						outChan <- *uavTalkObject
-					} else {
-						log.Warning(err)
-						PrintHex(buffer[from:to], to-from)
-					}
-				} else {
-					// the packet is complete but its integrity is seriously questionned,
-					// we go through so we can strip it from buffer
-					log.Warning(err)
-					PrintHex(buffer[from:to], to-from)
-				}
-				copy(buffer, buffer[to:])
-				buffer = buffer[0 : len(buffer)-to]
-			}
-		}
-	}()
-
-	// To Controller
-	go func() {
-		for {
-			var binaryPacket []byte
-			select {
-			case packet := <-inChan:
-				binaryPacket, err = packet.toBinary()
-				if err != nil {
-					log.Warning(err)
-					continue
-				}
-			}
-
-			_, err = link.Write(binaryPacket)
-			if err != nil {
-				log.Fatal(err)
-				return
-			}
-		}
-	}()
-	select {}
+	return definitions, nil
 }
 
-// newDefinitions loads all xml files from a directory
-func newDefinitions(dir string) (Definitions, error) {
-	fileInfos, err := ioutil.ReadDir(dir)
-	if err != nil {
+// decodeDefinition decodes the object of an xml file, nothing is checked nor computed
+func decodeDefinition(data []byte) (*Definition, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var content = &struct {
+		Definition *Definition `xml:"object"`
+	}{}
+	if err := decoder.Decode(content); err != nil {
 		return nil, err
 	}
-
-	AllDefinitions := make([]*Definition, 0, 150)
-	for _, fileInfo := range fileInfos {
-		filePath := fmt.Sprintf("%s%s", dir, fileInfo.Name())
-		definition, err := newDefinition(filePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		_, err = NewMetaDefinition(definition)
-		if err != nil {
-			log.Fatal(err)
-		}
-		AllDefinitions = append(AllDefinitions, definition, definition.Meta)
+	if content.Definition == nil {
+		return nil, errors.New("no object defined")
 	}
-	return AllDefinitions, nil
+	return content.Definition, nil
 }
 
-// NewDefinition create a Definition from an xml file.
-func newDefinition(filePath string) (*Definition, error) {
-	file, err := os.Open(filePath)
+// NewDefinition create a Definition from the content of an xml file.
+func newDefinition(data []byte) (*Definition, error) {
+	definition, err := decodeDefinition(data)
 	if err != nil {
 		return nil, err
 	}
 
-	decoder := xml.NewDecoder(file)
-
-	var content = &struct {
-		Definition *Definition `xml:"object"`
-	}{}
-	decoder.Decode(content)
-
-	definition := content.Definition
 	if err := definition.FinishSetup(); err != nil {
 		return nil, err
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 )
 
 func readFromUAVTalk(field *FieldDefinition, reader *bytes.Reader) (interface{}, error) {
@@ -11,13 +12,13 @@ func readFromUAVTalk(field *FieldDefinition, reader *bytes.Reader) (interface{},
 	var result interface{}
 	switch typeInfo.Name {
 	case "int8":
-		tmp := uint8(0)
+		tmp := int8(0)
 		if err := binary.Read(reader, binary.LittleEndian, &tmp); err != nil {
 			return nil, err
 		}
 		result = tmp
 	case "int16":
-		tmp := uint16(0)
+		tmp := int16(0)
 		if err := binary.Read(reader, binary.LittleEndian, &tmp); err != nil {
 			return nil, err
 		}
@@ -63,7 +64,11 @@ func readFromUAVTalk(field *FieldDefinition, reader *bytes.Reader) (interface{},
 	}
 
 	if typeInfo.Name == "enum" {
-		result = field.Options[result.(uint8)] // haha
+		index := int(result.(uint8))
+		if index >= len(field.Options) {
+			return nil, fmt.Errorf("%s: invalid enum value %d", field.Name, index)
+		}
+		result = field.Options[index]
 	}
 	return result, nil
 }
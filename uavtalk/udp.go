@@ -0,0 +1,140 @@
+package uavtalk
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * UDP link, used by SITL and by radio modems forwarding telemetry over IP.
+ * Each datagram carries one or more UAVTalk packets, payloads are handed to the reader
+ * as a stream so they go through the same packet reassembly as other links.
+ * Without a fixed peer, the link locks onto the first sender, the datagrams of others are dropped.
+ * Once that peer stays silent for PeerTimeout the link fails, and the supervisor opens it again
+ * to learn the next one. Until a peer is known, writes fail with errNoPeer, the packets are lost
+ * but the link stays up.
+ */
+
+const maxUDPDatagramSize = 65507
+const udpReadTimeout = 100 * time.Millisecond
+const defaultUDPPeerTimeout = 10 * time.Second
+
+// errNoPeer is returned by the writes of a UDP link which has not heard from its peer yet
+var errNoPeer = errors.New("No UDP peer to write to yet")
+
+// UDPConfig holds the settings of a UDP link
+type UDPConfig struct {
+	Address     string        // local address to bind, eg. :9000
+	Peer        string        // host:port to send to, if empty it is learnt from incoming datagrams
+	PeerTimeout time.Duration // silence after which a learnt peer is forgotten, defaults to 10s
+}
+
+type udpLink struct {
+	conn        *net.UDPConn
+	fixedPeer   bool
+	peerTimeout time.Duration
+
+	mutex sync.Mutex
+	peer  *net.UDPAddr
+
+	lastHeard time.Time
+
+	datagram []byte
+	pending  []byte
+}
+
+var _ Linker = (*udpLink)(nil)
+
+// NewUDPLink binds the local address, writes fail until the peer is known
+func NewUDPLink(config UDPConfig) (Linker, error) {
+	localAddr, err := net.ResolveUDPAddr("udp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if config.PeerTimeout == 0 {
+		config.PeerTimeout = defaultUDPPeerTimeout
+	}
+
+	l := &udpLink{datagram: make([]byte, maxUDPDatagramSize), peerTimeout: config.PeerTimeout}
+	if len(config.Peer) > 0 {
+		if l.peer, err = net.ResolveUDPAddr("udp", config.Peer); err != nil {
+			return nil, err
+		}
+		l.fixedPeer = true
+	}
+
+	if l.conn, err = net.ListenUDP("udp", localAddr); err != nil {
+		return nil, err
+	}
+	log.Infof("UAVTalk UDP link bound to %s", l.conn.LocalAddr())
+	return l, nil
+}
+
+func (l *udpLink) Read(b []byte) (int, error) {
+	if len(l.pending) == 0 {
+		l.conn.SetReadDeadline(time.Now().Add(udpReadTimeout))
+		n, addr, err := l.conn.ReadFromUDP(l.datagram)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return 0, l.checkPeer()
+			}
+			return 0, err
+		}
+
+		if l.acceptFrom(addr) == false {
+			return 0, l.checkPeer()
+		}
+		l.lastHeard = time.Now()
+		l.pending = l.datagram[:n]
+	}
+
+	n := copy(b, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// acceptFrom filters datagrams from other senders than the peer, the first sender becomes the peer if it is not fixed
+func (l *udpLink) acceptFrom(addr *net.UDPAddr) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.peer == nil {
+		log.Infof("UAVTalk UDP peer is %s", addr)
+		l.peer = addr
+		return true
+	}
+
+	if addr.IP.Equal(l.peer.IP) == false || addr.Port != l.peer.Port {
+		log.Debugf("UAVTalk UDP datagram from %s dropped, the peer is %s", addr, l.peer)
+		return false
+	}
+	return true
+}
+
+// checkPeer fails once a learnt peer has been silent for too long, so a new one can be learnt
+func (l *udpLink) checkPeer() error {
+	if l.fixedPeer || l.lastHeard.IsZero() || time.Since(l.lastHeard) < l.peerTimeout {
+		return nil
+	}
+	return fmt.Errorf("UAVTalk UDP peer silent for %s", time.Since(l.lastHeard))
+}
+
+func (l *udpLink) Write(b []byte) (int, error) {
+	l.mutex.Lock()
+	peer := l.peer
+	l.mutex.Unlock()
+
+	if peer == nil {
+		return 0, errNoPeer
+	}
+	return l.conn.WriteToUDP(b, peer)
+}
+
+func (l *udpLink) Close() error {
+	return l.conn.Close()
+}
@@ -0,0 +1,127 @@
+package uavtalk
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestUDPLink(t *testing.T, config UDPConfig) (*udpLink, *net.UDPAddr) {
+	config.Address = "127.0.0.1:0"
+	link, err := NewUDPLink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := link.(*udpLink)
+	return l, l.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func newUDPPeer(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readUDPLink reads the link until it gets data, reads return nothing on timeouts and dropped datagrams
+func readUDPLink(t *testing.T, link *udpLink) ([]byte, error) {
+	buffer := make([]byte, 64)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		n, err := link.Read(buffer)
+		if err != nil || n > 0 {
+			return buffer[:n], err
+		}
+	}
+	return nil, nil
+}
+
+func readUDPPeer(t *testing.T, peer *net.UDPConn) []byte {
+	buffer := make([]byte, 64)
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := peer.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer[:n]
+}
+
+func TestUDPLinkLearnsPeer(t *testing.T) {
+	link, address := newTestUDPLink(t, UDPConfig{})
+	defer link.Close()
+
+	if _, err := link.Write([]byte{1}); err != errNoPeer {
+		t.Errorf("write before the peer is known: %v, expected %s", err, errNoPeer)
+	}
+
+	first, other := newUDPPeer(t), newUDPPeer(t)
+	defer first.Close()
+	defer other.Close()
+
+	first.WriteToUDP([]byte{1, 2}, address)
+	if data, err := readUDPLink(t, link); err != nil || bytes.Equal(data, []byte{1, 2}) == false {
+		t.Fatalf("read % x, %v, expected 01 02", data, err)
+	}
+
+	// the datagrams of other senders are dropped, the link stays locked onto the first one
+	other.WriteToUDP([]byte{3}, address)
+	first.WriteToUDP([]byte{4}, address)
+	if data, err := readUDPLink(t, link); err != nil || bytes.Equal(data, []byte{4}) == false {
+		t.Errorf("read % x, %v, expected 04", data, err)
+	}
+
+	if _, err := link.Write([]byte{5}); err != nil {
+		t.Fatal(err)
+	}
+	if data := readUDPPeer(t, first); bytes.Equal(data, []byte{5}) == false {
+		t.Errorf("peer read % x, expected 05", data)
+	}
+}
+
+func TestUDPLinkFixedPeer(t *testing.T) {
+	peer, other := newUDPPeer(t), newUDPPeer(t)
+	defer peer.Close()
+	defer other.Close()
+
+	link, address := newTestUDPLink(t, UDPConfig{Peer: peer.LocalAddr().String()})
+	defer link.Close()
+
+	if _, err := link.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if data := readUDPPeer(t, peer); bytes.Equal(data, []byte{1}) == false {
+		t.Errorf("peer read % x, expected 01", data)
+	}
+
+	other.WriteToUDP([]byte{2}, address)
+	peer.WriteToUDP([]byte{3}, address)
+	if data, err := readUDPLink(t, link); err != nil || bytes.Equal(data, []byte{3}) == false {
+		t.Errorf("read % x, %v, expected 03", data, err)
+	}
+}
+
+func TestUDPLinkPeerTimeout(t *testing.T) {
+	link, address := newTestUDPLink(t, UDPConfig{PeerTimeout: 200 * time.Millisecond})
+	defer link.Close()
+
+	// nothing heard yet, nothing to time out
+	if _, err := readUDPLink(t, link); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := newUDPPeer(t)
+	defer peer.Close()
+	peer.WriteToUDP([]byte{1}, address)
+	if _, err := readUDPLink(t, link); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := readUDPLink(t, link); err == nil {
+		t.Fatal("the peer did not time out")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("the peer timed out after %s", elapsed)
+	}
+}
@@ -0,0 +1,159 @@
+package uavtalk
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Validation of UAVObject XML definitions.
+ * Loading stops at the first problem, validation reports all of them, file by file, eg. to check definitions in CI.
+ * The object IDs are checked across the whole set, meta objects included (their ID is the object ID + 1).
+ */
+
+// enums are sent as uint8
+const maxEnumOptions = 256
+
+// DefinitionError is a problem found in a definition file
+type DefinitionError struct {
+	File string
+	Err  error
+}
+
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Err)
+}
+
+// ValidateDefinitionFiles checks definition files, it returns all the problems found, none if the files can be loaded
+func ValidateDefinitionFiles(files DefinitionFiles) []error {
+	var errs []error
+	report := func(file string, err error) {
+		errs = append(errs, &DefinitionError{file, err})
+	}
+
+	ids := map[uint32]string{}
+	names := map[string]string{}
+	// claim reserves the name and object ID of a definition, false if they are already used
+	claim := func(file string, name string, objectID uint32) bool {
+		owner := fmt.Sprintf("%s (%s)", name, file)
+		ok := true
+		if other, exists := names[strings.ToLower(name)]; exists {
+			report(file, fmt.Errorf("%s is already defined by %s", name, other))
+			ok = false
+		} else {
+			names[strings.ToLower(name)] = owner
+		}
+		if other, exists := ids[objectID]; exists {
+			report(file, fmt.Errorf("%s has the object ID %d of %s", name, objectID, other))
+			ok = false
+		} else {
+			ids[objectID] = owner
+		}
+		return ok
+	}
+
+	for _, file := range files.Names() {
+		definition, err := decodeDefinition(files[file])
+		if err != nil {
+			report(file, err)
+			continue
+		}
+
+		problems := definition.validate()
+		for _, err := range problems {
+			report(file, err)
+		}
+		if len(problems) > 0 {
+			// the object ID can not be computed
+			continue
+		}
+
+		if err := definition.FinishSetup(); err != nil {
+			report(file, err)
+			continue
+		}
+		calculateID(definition)
+
+		if claim(file, definition.Name, definition.ObjectID) {
+			claim(file, definition.Name+"Meta", definition.ObjectID+1)
+		}
+	}
+	return errs
+}
+
+// validate checks a definition as decoded, before FinishSetup
+func (definition *Definition) validate() []error {
+	var errs []error
+	if len(definition.Name) == 0 {
+		errs = append(errs, fmt.Errorf("object without name"))
+	}
+
+	fields := map[string]*FieldDefinition{}
+	for _, field := range definition.Fields {
+		if len(field.Name) == 0 {
+			errs = append(errs, fmt.Errorf("%s: field without name", definition.Name))
+			continue
+		}
+		if _, exists := fields[field.Name]; exists {
+			errs = append(errs, fmt.Errorf("%s: duplicate field %s", definition.Name, field.Name))
+			continue
+		}
+		fields[field.Name] = field
+	}
+
+	for _, field := range definition.Fields {
+		if len(field.Name) == 0 {
+			continue
+		}
+		if err := field.validate(fields); err != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %s", definition.Name, field.Name, err))
+		}
+	}
+	return errs
+}
+
+// validate checks a field as decoded, fields indexes the fields of its definition by name
+func (field *FieldDefinition) validate(fields map[string]*FieldDefinition) error {
+	if len(field.CloneOf) != 0 {
+		clonedField, exists := fields[field.CloneOf]
+		if exists == false {
+			return fmt.Errorf("clone of %s, which is not defined", field.CloneOf)
+		}
+		if len(clonedField.CloneOf) != 0 {
+			return fmt.Errorf("clone of %s, which is a clone itself", field.CloneOf)
+		}
+		return nil
+	}
+
+	if _, err := TypeInfos.FieldTypeForString(field.Type); err != nil {
+		return fmt.Errorf("unknown type %q", field.Type)
+	}
+
+	elementNames := field.ElementNames
+	if len(field.ElementNamesAttr) > 0 {
+		if len(elementNames) > 0 {
+			return fmt.Errorf("element names given both as attribute and as elements")
+		}
+		elementNames = strings.Split(sanitizeListString(field.ElementNamesAttr), ",")
+	}
+	if field.Elements != 0 && len(elementNames) > 0 && field.Elements != len(elementNames) {
+		return fmt.Errorf("%d elements, but %d element names", field.Elements, len(elementNames))
+	}
+
+	if field.Type == "enum" {
+		options := field.Options
+		if len(field.OptionsAttr) > 0 {
+			if len(options) > 0 {
+				return fmt.Errorf("options given both as attribute and as elements")
+			}
+			options = strings.Split(sanitizeListString(field.OptionsAttr), ",")
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("enum without options")
+		}
+		if len(options) > maxEnumOptions {
+			return fmt.Errorf("enum with %d options, at most %d can be sent", len(options), maxEnumOptions)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package uavtalk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDefinitionFiles(t *testing.T) {
+	tests := []struct {
+		dir      string
+		expected []string // the beginning of each error
+	}{
+		{"testdata/definitions/", nil},
+		{"testdata/invalid/duplicatename/", []string{
+			"b.xml: Duplicate is already defined by Duplicate (a.xml)",
+		}},
+		{"testdata/invalid/duplicateid/", []string{
+			"collision3894.xml: Collision3894 has the object ID 2856585494 of Collision3860 (collision3860.xml)",
+		}},
+		{"testdata/invalid/metaname/", []string{
+			"collidingmeta.xml: CollidingMeta is already defined by CollidingMeta (colliding.xml)",
+		}},
+		{"testdata/invalid/unknowntype/", []string{
+			`unknowntype.xml: UnknownType.Value: unknown type "float128"`,
+		}},
+		{"testdata/invalid/duplicatefield/", []string{
+			"duplicatefield.xml: DuplicateField: duplicate field Value",
+		}},
+		{"testdata/invalid/elementnames/", []string{
+			"elementnames.xml: ElementNames.Value: 2 elements, but 3 element names",
+		}},
+		{"testdata/invalid/options/", []string{
+			"options.xml: Options.Value: enum with 257 options, at most 256 can be sent",
+		}},
+		{"testdata/invalid/clonemissing/", []string{
+			"clonemissing.xml: CloneMissing.Clone: clone of Missing, which is not defined",
+		}},
+		{"testdata/invalid/cloneofclone/", []string{
+			"cloneofclone.xml: CloneOfClone.CloneOfClone: clone of Clone, which is a clone itself",
+		}},
+		{"testdata/invalid/malformed/", []string{
+			"malformed.xml: XML syntax error",
+		}},
+	}
+
+	for _, test := range tests {
+		files, err := ReadDefinitionFiles(test.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := ValidateDefinitionFiles(files)
+		if len(errs) != len(test.expected) {
+			t.Errorf("%s: %d errors %v, expected %d", test.dir, len(errs), errs, len(test.expected))
+			continue
+		}
+		for i, err := range errs {
+			if _, ok := err.(*DefinitionError); ok == false {
+				t.Errorf("%s: %T returned, expected a *DefinitionError", test.dir, err)
+			}
+			if strings.HasPrefix(err.Error(), test.expected[i]) == false {
+				t.Errorf("%s: %q, expected %q", test.dir, err, test.expected[i])
+			}
+		}
+
+		// what validates loads
+		if _, err := NewRegistryFromFiles(files); len(errs) == 0 && err != nil {
+			t.Errorf("%s: no problem found, but not loaded: %s", test.dir, err)
+		}
+	}
+}
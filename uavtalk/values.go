@@ -0,0 +1,269 @@
+package uavtalk
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/**
+ * Typed values of the field elements.
+ * Decoded values have the Go type matching the field type: int8, int16, int32, uint8, uint16, uint32, float32,
+ * and string for enums.
+ * Values to encode can be given as any Go number (float64 when they come from JSON), they are converted to the
+ * field type with range checking, enums can be given by option name or by index.
+ */
+
+// ValueError is returned when a value can not be converted to the type of its field
+type ValueError struct {
+	Path  string // eg. TrimSettings.Trim.Pitch or ActuatorCommand.Channel[3]
+	Value interface{}
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Path, e.Value, e.Err)
+}
+
+type integerRange struct {
+	min, max float64
+}
+
+var integerRanges = map[string]integerRange{
+	"int8":   {math.MinInt8, math.MaxInt8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"uint8":  {0, math.MaxUint8},
+	"uint16": {0, math.MaxUint16},
+	"uint32": {0, math.MaxUint32},
+}
+
+// Convert converts value to the Go type of the field elements, see above
+func (field *FieldDefinition) Convert(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	if field.FieldTypeInfo.Name == "enum" {
+		return field.convertEnum(value)
+	}
+
+	number, ok := numberToFloat64(value)
+	if ok == false {
+		return nil, fmt.Errorf("%T is not a number", value)
+	}
+
+	if field.FieldTypeInfo.Name == "float" {
+		if math.Abs(number) > math.MaxFloat32 && math.IsInf(number, 0) == false {
+			return nil, fmt.Errorf("out of range for float")
+		}
+		return float32(number), nil
+	}
+
+	r, ok := integerRanges[field.FieldTypeInfo.Name]
+	if ok == false {
+		return nil, fmt.Errorf("unknown type %s", field.FieldTypeInfo.Name)
+	}
+	if math.Trunc(number) != number {
+		return nil, fmt.Errorf("%s expects an integer", field.FieldTypeInfo.Name)
+	}
+	if number < r.min || number > r.max {
+		return nil, fmt.Errorf("out of range for %s (%.0f..%.0f)", field.FieldTypeInfo.Name, r.min, r.max)
+	}
+
+	switch field.FieldTypeInfo.Name {
+	case "int8":
+		return int8(number), nil
+	case "int16":
+		return int16(number), nil
+	case "int32":
+		return int32(number), nil
+	case "uint8":
+		return uint8(number), nil
+	case "uint16":
+		return uint16(number), nil
+	}
+	return uint32(number), nil
+}
+
+// convertEnum returns the option name of an enum value, given by name or by index
+func (field *FieldDefinition) convertEnum(value interface{}) (string, error) {
+	if option, ok := value.(string); ok {
+		if _, err := valueForEnumString(field, option); err != nil {
+			return "", fmt.Errorf("unknown option, expected one of %v", field.Options)
+		}
+		return option, nil
+	}
+
+	index, ok := numberToFloat64(value)
+	if ok == false {
+		return "", fmt.Errorf("%T is not an enum option", value)
+	}
+	if math.Trunc(index) != index || index < 0 || int(index) >= len(field.Options) {
+		return "", fmt.Errorf("no such option, expected one of %v", field.Options)
+	}
+	return field.Options[int(index)], nil
+}
+
+func numberToFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// parseDefaults parses the default values of a field, once its elements and options are known,
+// a single value is the default of all the elements, fields without default values default to zero, or the first option
+func (field *FieldDefinition) parseDefaults() error {
+	field.Defaults = make([]interface{}, field.Elements)
+	if len(strings.TrimSpace(field.DefaultValue)) == 0 {
+		for i := range field.Defaults {
+			field.Defaults[i] = field.zero()
+		}
+		return nil
+	}
+
+	values := strings.Split(sanitizeListString(field.DefaultValue), ",")
+	if len(values) != 1 && len(values) != field.Elements {
+		return fmt.Errorf("%s: %d default values, 1 or %d expected", field.Name, len(values), field.Elements)
+	}
+	for i := range field.Defaults {
+		s := values[0]
+		if len(values) > 1 {
+			s = values[i]
+		}
+		value, err := field.parseValue(s)
+		if err != nil {
+			return fmt.Errorf("%s: default value: %s", field.Name, err)
+		}
+		field.Defaults[i] = value
+	}
+	return nil
+}
+
+func (field *FieldDefinition) zero() interface{} {
+	if field.Type == "enum" {
+		if len(field.Options) == 0 {
+			return ""
+		}
+		return field.Options[0]
+	}
+	return float64(0)
+}
+
+// DefaultData returns the default values of all the fields, shaped as data to encode
+func (definition *Definition) DefaultData() map[string]interface{} {
+	data := make(map[string]interface{}, len(definition.Fields))
+	for _, field := range definition.Fields {
+		data[field.Name] = field.defaultValue()
+	}
+	return data
+}
+
+func (field *FieldDefinition) defaultValue() interface{} {
+	element := func(i int) interface{} {
+		if i < len(field.Defaults) {
+			return field.Defaults[i]
+		}
+		return field.zero()
+	}
+
+	if field.Elements > 1 && len(field.ElementNames) == 0 {
+		values := make([]interface{}, field.Elements)
+		for i := range values {
+			values[i] = element(i)
+		}
+		return values
+	} else if field.Elements > 1 && len(field.ElementNames) > 0 {
+		values := make(map[string]interface{}, field.Elements)
+		for i, name := range field.ElementNames {
+			values[name] = element(i)
+		}
+		return values
+	}
+	return element(0)
+}
+
+// FillMissing returns data completed with the values of current, then with the default values,
+// current can be nil, eg. when the values of the object were not received yet.
+// Elements missing from named elements are completed too, arrays are taken as a whole.
+func (definition *Definition) FillMissing(data map[string]interface{}, current map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(definition.Fields))
+	for name, value := range data {
+		result[name] = value
+	}
+
+	for _, field := range definition.Fields {
+		fallback, ok := current[field.Name]
+		if ok == false {
+			fallback = field.defaultValue()
+		}
+
+		value, ok := result[field.Name]
+		if ok == false || value == nil {
+			result[field.Name] = fallback
+			continue
+		}
+
+		values, ok := value.(map[string]interface{})
+		fallbacks, _ := fallback.(map[string]interface{})
+		if ok == false || len(field.ElementNames) == 0 || field.Elements <= 1 {
+			continue
+		}
+		completed := make(map[string]interface{}, field.Elements)
+		for i, name := range field.ElementNames {
+			if value, ok := values[name]; ok && value != nil {
+				completed[name] = value
+			} else if value, ok := fallbacks[name]; ok {
+				completed[name] = value
+			} else {
+				completed[name] = field.Defaults[i]
+			}
+		}
+		result[field.Name] = completed
+	}
+	return result
+}
+
+// forEachElement calls f with the value of each element of a field value, values which are not shaped
+// as the field expects are skipped, they are reported when encoding
+func (field *FieldDefinition) forEachElement(value interface{}, path string, f func(element int, path string, value interface{})) {
+	if field.Elements > 1 && len(field.ElementNames) == 0 {
+		values, _ := value.([]interface{})
+		for i, value := range values {
+			f(i, fmt.Sprintf("%s[%d]", path, i), value)
+		}
+	} else if field.Elements > 1 && len(field.ElementNames) > 0 {
+		values, _ := value.(map[string]interface{})
+		for i, name := range field.ElementNames {
+			if value, ok := values[name]; ok {
+				f(i, fmt.Sprintf("%s.%s", path, name), value)
+			}
+		}
+	} else {
+		f(0, path, value)
+	}
+}
@@ -0,0 +1,186 @@
+package uavtalk
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testField(t *testing.T, definition *Definition, name string) *FieldDefinition {
+	field, err := definition.Fields.FieldForName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return field
+}
+
+func TestFieldConvert(t *testing.T) {
+	definition := testDefinition(t, testRegistry(t), "TestValues")
+
+	tests := []struct {
+		field    string
+		value    interface{}
+		expected interface{} // nil when the conversion fails
+	}{
+		{"Int8", float64(math.MinInt8), int8(math.MinInt8)},
+		{"Int8", float64(math.MaxInt8), int8(math.MaxInt8)},
+		{"Int8", float64(-1), int8(-1)},
+		{"Int8", float64(math.MinInt8 - 1), nil},
+		{"Int8", float64(math.MaxInt8 + 1), nil},
+		{"Int16", float64(math.MinInt16), int16(math.MinInt16)},
+		{"Int16", float64(math.MaxInt16), int16(math.MaxInt16)},
+		{"Int16", float64(math.MinInt16 - 1), nil},
+		{"Int16", float64(math.MaxInt16 + 1), nil},
+		{"Int32", float64(math.MinInt32), int32(math.MinInt32)},
+		{"Int32", float64(math.MaxInt32), int32(math.MaxInt32)},
+		{"Int32", float64(math.MinInt32 - 1), nil},
+		{"Int32", float64(math.MaxInt32 + 1), nil},
+		{"UInt8", float64(0), uint8(0)},
+		{"UInt8", float64(math.MaxUint8), uint8(math.MaxUint8)},
+		{"UInt8", float64(-1), nil},
+		{"UInt8", float64(math.MaxUint8 + 1), nil},
+		{"UInt16", float64(math.MaxUint16), uint16(math.MaxUint16)},
+		{"UInt16", float64(math.MaxUint16 + 1), nil},
+		{"UInt32", float64(math.MaxUint32), uint32(math.MaxUint32)},
+		{"UInt32", float64(math.MaxUint32 + 1), nil},
+		{"Int16", int(-3), int16(-3)},
+		{"Int16", uint8(3), int16(3)},
+		{"Int16", float64(1.5), nil},
+		{"Int16", "1", nil},
+		{"Int16", true, nil},
+		{"Int16", nil, nil},
+		{"Float", float64(1.5), float32(1.5)},
+		{"Float", float64(math.MaxFloat64), nil},
+		{"Float", "1.5", nil},
+		{"Mode", "Auto", "Auto"},
+		{"Mode", float64(1), "On"},
+		{"Mode", "auto", nil},
+		{"Mode", float64(3), nil},
+		{"Mode", float64(-1), nil},
+		{"Mode", float64(0.5), nil},
+		{"Mode", true, nil},
+	}
+
+	for _, test := range tests {
+		result, err := testField(t, definition, test.field).Convert(test.value)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s %v (%T): converted to %v (%T), expected an error", test.field, test.value, test.value, result, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v (%T): %s", test.field, test.value, test.value, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%s %v (%T): converted to %v (%T), expected %v (%T)", test.field, test.value, test.value, result, result, test.expected, test.expected)
+		}
+	}
+}
+
+func testValuesData() map[string]interface{} {
+	return map[string]interface{}{
+		"Int8":   float64(math.MinInt8),
+		"Int16":  float64(math.MinInt16),
+		"Int32":  float64(math.MinInt32),
+		"UInt8":  float64(math.MaxUint8),
+		"UInt16": float64(math.MaxUint16),
+		"UInt32": float64(math.MaxUint32),
+		"Float":  float64(-0.25),
+		"Mode":   "Auto",
+		"Array":  []interface{}{float64(math.MaxInt8), float64(-1)},
+		"Named":  map[string]interface{}{"Roll": float64(math.MaxInt16), "Pitch": float64(-2)},
+	}
+}
+
+func TestValuesRoundTrip(t *testing.T) {
+	definition := testDefinition(t, testRegistry(t), "TestValues")
+
+	data, err := mapToUAVTalk(definition, testValuesData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != definition.Fields.ByteLength() {
+		t.Fatalf("%d bytes encoded, expected %d", len(data), definition.Fields.ByteLength())
+	}
+
+	decoded, err := uAVTalkToMap(definition, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"Int8":   int8(math.MinInt8),
+		"Int16":  int16(math.MinInt16),
+		"Int32":  int32(math.MinInt32),
+		"UInt8":  uint8(math.MaxUint8),
+		"UInt16": uint16(math.MaxUint16),
+		"UInt32": uint32(math.MaxUint32),
+		"Float":  float32(-0.25),
+		"Mode":   "Auto",
+		"Array":  []interface{}{int8(math.MaxInt8), int8(-1)},
+		"Named":  map[string]interface{}{"Roll": int16(math.MaxInt16), "Pitch": int16(-2)},
+	}
+	if reflect.DeepEqual(decoded, expected) == false {
+		t.Errorf("decoded %v, expected %v", decoded, expected)
+	}
+}
+
+func TestValuesDecodeInvalidEnum(t *testing.T) {
+	definition := testDefinition(t, testRegistry(t), "TestValues")
+
+	data, err := mapToUAVTalk(definition, testValuesData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fields are sent sorted by size
+	offset := 0
+	for _, field := range definition.Fields {
+		if field.Name == "Mode" {
+			break
+		}
+		offset += field.FieldTypeInfo.Size * field.Elements
+	}
+	data[offset] = 3
+	if _, err := uAVTalkToMap(definition, data); err == nil {
+		t.Error("enum value 3 decoded, Mode has 3 options")
+	}
+}
+
+func TestValuesEncodeErrors(t *testing.T) {
+	definition := testDefinition(t, testRegistry(t), "TestValues")
+
+	tests := []struct {
+		field string
+		value interface{} // nil removes the field
+		path  string
+	}{
+		{"Int8", nil, "TestValues.Int8"},
+		{"Int8", float64(200), "TestValues.Int8"},
+		{"Mode", "Manual", "TestValues.Mode"},
+		{"Array", float64(1), "TestValues.Array"},
+		{"Array", []interface{}{float64(1)}, "TestValues.Array"},
+		{"Array", []interface{}{float64(1), "a"}, "TestValues.Array[1]"},
+		{"Named", []interface{}{float64(1), float64(2)}, "TestValues.Named"},
+		{"Named", map[string]interface{}{"Roll": float64(1)}, "TestValues.Named.Pitch"},
+	}
+
+	for _, test := range tests {
+		data := testValuesData()
+		if test.value == nil {
+			delete(data, test.field)
+		} else {
+			data[test.field] = test.value
+		}
+
+		_, err := mapToUAVTalk(definition, data)
+		valueError, ok := err.(*ValueError)
+		if ok == false {
+			t.Errorf("%s %v: %v, expected a *ValueError", test.field, test.value, err)
+			continue
+		}
+		if valueError.Path != test.path {
+			t.Errorf("%s %v: error on %s, expected %s", test.field, test.value, valueError.Path, test.path)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "sync"
+
+/**
+ * The last values of each object instance, as received from the flight controller or acked by it,
+ * fields missing from SET_ actions are taken from there, so that setting a field does not reset the others.
+ * The values are dropped each time the link comes up, the flight controller may have changed.
+ */
+
+type valueKey struct {
+	name       string
+	instanceID uint16
+}
+
+// valueCache is safe for concurrent use
+type valueCache struct {
+	mutex  sync.Mutex
+	values map[valueKey]map[string]interface{}
+}
+
+func newValueCache() *valueCache {
+	return &valueCache{values: map[valueKey]map[string]interface{}{}}
+}
+
+// get returns the last values of an object instance, nil if unknown, they must not be modified
+func (c *valueCache) get(name string, instanceID uint16) map[string]interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[valueKey{name, instanceID}]
+}
+
+// set stores a copy of data, nested values are not copied, they must not be modified afterwards
+func (c *valueCache) set(name string, instanceID uint16, data map[string]interface{}) {
+	values := make(map[string]interface{}, len(data))
+	for field, value := range data {
+		values[field] = value
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[valueKey{name, instanceID}] = values
+}
+
+func (c *valueCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values = map[valueKey]map[string]interface{}{}
+}
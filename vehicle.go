@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HackerLoop/rotonde-client.go"
+	"github.com/HackerLoop/rotonde-uavtalk/uavtalk"
+	"github.com/HackerLoop/rotonde/shared"
+	log "github.com/Sirupsen/logrus"
+	"github.com/vitaminwater/handlers.go"
+)
+
+/**
+ * A Vehicle is a flight controller served by the bridge, each one owns its connection and handler graph.
+ * Rotonde events carry the name of the vehicle they come from in their "vehicle" field,
+ * actions are routed with the same field, which is optional when there is only one vehicle.
+ * The definitions of the objects are published once per definition set, so vehicles running different firmwares each expose theirs.
+ */
+
+const vehicleField = "vehicle"
+const defaultVehicleName = "default"
+
+// Vehicle _
+type Vehicle struct {
+	Name string
+
+	connection     *uavtalk.Connection
+	telemetry      *uavtalk.Telemetry
+	session        *uavtalk.Session
+	transactions   *uavtalk.Transactions
+	persistWaiters *persistWaiters
+	values         *valueCache
+	client         *client.Client
+	definitions    *rotondeDefinitions
+}
+
+// NewVehicle creates a vehicle, nothing happens until Start is called
+func NewVehicle(name string, linkURI string, registry *uavtalk.Registry, library *uavtalk.Library, sessionCache *uavtalk.SessionCache, client *client.Client, rotondeDefinitions *rotondeDefinitions) *Vehicle {
+	connection := uavtalk.NewConnection(linkURI, registry)
+	connection.Library = library
+	session := uavtalk.NewSession(connection)
+	session.Cache = sessionCache
+	return &Vehicle{
+		Name:           name,
+		connection:     connection,
+		telemetry:      uavtalk.NewTelemetry(connection),
+		session:        session,
+		transactions:   uavtalk.NewTransactions(connection),
+		persistWaiters: newPersistWaiters(),
+		values:         newValueCache(),
+		client:         client,
+		definitions:    rotondeDefinitions,
+	}
+}
+
+// Start starts the connection and its handlers
+func (v *Vehicle) Start() {
+	go v.connection.Start()
+	go v.telemetry.Start()
+	go v.session.Start()
+	rootOut := handlers.NewHandlerManager(chanCast(v.connection.OutChan, v.connection.StateChan), handlers.PassAll, handlers.Noop, handlers.Noop)
+	v.initAuthHandlers(rootOut)
+	v.initStreamHandlers(rootOut)
+}
+
+func (v *Vehicle) sendEvent(event *rotonde.Event) {
+	event.Data[vehicleField] = v.Name
+	v.client.SendMessage(*event)
+}
+
+func (v *Vehicle) handleAction(action rotonde.Action) {
+	delete(action.Data, vehicleField)
+	if strings.HasPrefix(action.Identifier, "SET_") {
+		v.handleSetAction(action)
+		return
+	}
+
+	p := toUAVTalkPacket(v.connection.Registry(), action)
+	if p == nil {
+		return
+	}
+	if p.Cmd != uavtalk.ObjectRequest {
+		if err := v.connection.Send(*p); err != nil {
+			log.Warningf("%s: %s", v.Name, err)
+		}
+		return
+	}
+	_, err := v.transactions.Send(p, func(result uavtalk.TransactionResult) {
+		if result.Status != uavtalk.TransactionAcked {
+			log.Warningf("%s: %s %s: %s", v.Name, action.Identifier, result.Status, result.Err)
+		}
+	})
+	if err != nil {
+		log.Warning(err)
+	}
+}
+
+// handleSetAction writes an object, its outcome is reported to rotonde, see results.go
+func (v *Vehicle) handleSetAction(action rotonde.Action) {
+	result := newWriteResult(v, action)
+
+	p := toUAVTalkPacket(v.connection.Registry(), action)
+	if p == nil {
+		result.send(writeRefused, fmt.Errorf("unknown object"))
+		return
+	}
+	// nothing is written while the link is down, nor with definitions which do not match the firmware
+	if err := v.connection.CheckSend(*p); err != nil {
+		log.Warningf("%s: %s refused: %s", v.Name, action.Identifier, err)
+		result.send(writeRefused, err)
+		return
+	}
+	p.Data = p.Definition.FillMissing(p.Data, v.values.get(p.Definition.Name, p.InstanceID))
+	if err := p.Definition.CheckLimits(p.Data); err != nil {
+		log.Warningf("%s: %s refused: %s", v.Name, action.Identifier, err)
+		result.send(writeRefused, err)
+		return
+	}
+
+	// the values are cached once the flight controller has them: when acked, or when it sends the object back
+	if p.Cmd == uavtalk.ObjectCmd {
+		if err := v.connection.Send(*p); err != nil {
+			log.Warningf("%s: %s refused: %s", v.Name, action.Identifier, err)
+			result.send(writeRefused, err)
+			return
+		}
+		result.send(writeSent, nil)
+		return
+	}
+	_, err := v.transactions.Send(p, func(transaction uavtalk.TransactionResult) {
+		if transaction.Status != uavtalk.TransactionAcked {
+			log.Warningf("%s: %s %s: %s", v.Name, action.Identifier, transaction.Status, transaction.Err)
+		} else {
+			v.values.set(p.Definition.Name, p.InstanceID, p.Data)
+		}
+		result.send(transaction.Status.String(), transaction.Err)
+		if transaction.Status == uavtalk.TransactionAcked && p.Definition.Settings == true {
+			v.persist(p.Definition, p.InstanceID, result)
+		}
+	})
+	if err != nil {
+		log.Warning(err)
+		result.send(writeRefused, err)
+	}
+}
+
+// persist saves a settings object to the flash of the flight controller
+func (v *Vehicle) persist(definition *uavtalk.Definition, instanceID uint16, result *writeResult) {
+	failed := func(err error) {
+		log.Warningf("%s: %s not persisted: %s", v.Name, definition.Name, err)
+		result.send(writePersistFailed, err)
+	}
+
+	packet, err := v.connection.Registry().CreatePersistObject(definition, instanceID)
+	if err != nil {
+		failed(err)
+		return
+	}
+
+	// the report can come before the ack
+	waiter := v.persistWaiters.wait(definition, instanceID, func(err error) {
+		if err != nil {
+			failed(err)
+			return
+		}
+		result.send(writePersisted, nil)
+	})
+	_, err = v.transactions.Send(&packet, func(transaction uavtalk.TransactionResult) {
+		if transaction.Status != uavtalk.TransactionAcked {
+			v.persistWaiters.resolve(waiter, fmt.Errorf("ObjectPersistence %s", transaction.Status))
+		}
+	})
+	if err != nil {
+		v.persistWaiters.resolve(waiter, err)
+	}
+}
+
+// Vehicles indexes vehicles by name
+type Vehicles map[string]*Vehicle
+
+func (vehicles Vehicles) forAction(action rotonde.Action) (*Vehicle, error) {
+	name, ok := action.Data[vehicleField].(string)
+	if ok == false {
+		if len(vehicles) == 1 {
+			for _, vehicle := range vehicles {
+				return vehicle, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: missing %s field", action.Identifier, vehicleField)
+	}
+
+	vehicle, ok := vehicles[name]
+	if ok == false {
+		return nil, fmt.Errorf("%s: unknown vehicle %s", action.Identifier, name)
+	}
+	return vehicle, nil
+}
+
+// vehicleFlag is the value of the -vehicle flag, name=uri
+type vehicleFlag struct {
+	name    string
+	linkURI string
+}
+
+type vehicleFlagList []vehicleFlag
+
+func (l *vehicleFlagList) String() string {
+	values := make([]string, 0, len(*l))
+	for _, f := range *l {
+		values = append(values, fmt.Sprintf("%s=%s", f.name, f.linkURI))
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *vehicleFlagList) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return fmt.Errorf("expected name=uri, got %s", value)
+	}
+	for _, f := range *l {
+		if f.name == parts[0] {
+			return fmt.Errorf("vehicle %s declared twice", f.name)
+		}
+	}
+	*l = append(*l, vehicleFlag{parts[0], parts[1]})
+	return nil
+}